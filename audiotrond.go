@@ -15,33 +15,23 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"time"
 
 	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/display"
 	"github.com/fhs/gompd/v2/mpd"
 	"github.com/tarm/serial"
 )
 
-func putWrapped(lcd *cfa635.Module, col, row int, data []byte) error {
-	for row < 4 && len(data) > 0 {
-		if err := lcd.Put(col, row, data); err != nil {
-			return err
-		}
-		if len(data) <= 20-col {
-			data = nil
-		} else {
-			data = data[20-col:]
-		}
-		col = 0
-		row++
-	}
-	return nil
-}
-
 func update[T comparable](dst *T, src T, mtime *time.Time, now time.Time) {
 	if *dst == src {
 		return
@@ -59,38 +49,116 @@ const (
 	paused
 )
 
-type foreground byte
-
 const (
-	_ foreground = iota
-	mpdForeground
-	clockForeground
+	// mpdPollInterval is the longest the event loop goes without querying
+	// MPD, even if MPD reports no changes. MPD disconnects clients that
+	// are quiet for a minute by default, and polling also corrects any
+	// drift in the extrapolated time elapsed.
+	mpdPollInterval = 30 * time.Second
+
+	// retryDelay is how long the event loop waits after failing to update
+	// the display before trying again.
+	retryDelay = 100 * time.Millisecond
 )
 
 type model struct {
 	State           playbackState
 	LastStateChange time.Time
 
-	Duration time.Duration
-	Elapsed  time.Duration
+	Duration          time.Duration
+	Elapsed           time.Duration
+	LastElapsedUpdate time.Time // When MPD reported Elapsed
 
 	Track               string
 	Artist              string
 	Album               string
 	LastTrackInfoUpdate time.Time
 
-	Foreground foreground
+	Volume  int // From 0 to 100, inclusive, or -1 if MPD has no mixer
+	Random  bool
+	Repeat  bool
+	Single  bool
+	Consume bool
+
+	SongID      string // Distinguishes a seek from a track change
+	Position    int    // Of the current song in the queue, from 0, or -1 if none
+	QueueLength int
+	NextSongID  string // Empty if no song follows the current one
+	NextTrack   string
+
+	Bitrate     int    // In kbit/s, or 0 if unknown
+	AudioFormat string // In MPD's notation, like "44100:16:2"
+	Error       string // MPD's last error, if any
+	UpdatingDB  bool
+
+	Overlay     overlayKind // What last changed noticeably
+	LastOverlay time.Time
+
+	LastKeyPress time.Time
+	Feedback     string // What the last key press did
+}
+
+// lastActivity returns the later of the last playback state change and the last
+// key press.
+func (m *model) lastActivity() time.Time {
+	if m.LastKeyPress.After(m.LastStateChange) {
+		return m.LastKeyPress
+	}
+	return m.LastStateChange
+}
+
+var (
+	configFlag = flag.String("config", "/etc/audiotrond.json", "configuration `file`; other flags override its settings")
+	flagConfig = defaultConfig()
+)
+
+func init() {
+	// Start without any keys so that -keys overrides only the keys it
+	// names.
+	flagConfig.Keys = keyMap{}
+	flagConfig.register(flag.CommandLine)
+}
+
+// conf is the configuration in effect, loaded at startup.
+var conf = defaultConfig()
+
+func openDisplay() display.Display {
+	switch conf.Display {
+	case "cfa635":
+		return display.NewCFA635(connectToCFA635())
+	case "terminal":
+		t, err := display.NewTerminal(os.Stdin, os.Stdout)
+		if err != nil {
+			panic(err)
+		}
+		// Log messages on stderr would scribble over the simulated LCD.
+		log.SetOutput(&heldLog)
+		return t
+	default:
+		panic(fmt.Errorf("unknown display %q", conf.Display))
+	}
 }
 
 func connectToCFA635() *cfa635.Module {
-	s, err := serial.OpenPort(&serial.Config{Name: "/dev/lcd", Baud: 115200})
+	dial := func() (io.ReadWriteCloser, error) {
+		s, err := serial.OpenPort(&serial.Config{Name: conf.Device, Baud: conf.Baud})
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	m, err := cfa635.Dial(dial, cfa635.WithBaudRate(conf.Baud), cfa635.WithRetry(cfa635.RetryPolicy{
+		Attempts:   4,
+		Backoff:    50 * time.Millisecond,
+		MaxBackoff: 500 * time.Millisecond,
+	}))
 	if err != nil {
 		panic(err)
 	}
-	m := cfa635.Connect(s)
 
+	reports := m.Subscribe(16)
 	go func() {
-		for r := m.ReadReport(); r != nil; r = m.ReadReport() {
+		for r := range reports.C {
 			log.Println("report:", r)
 		}
 	}()
@@ -98,15 +166,65 @@ func connectToCFA635() *cfa635.Module {
 	return m
 }
 
-func reportPanicOrClear(lcd *cfa635.Module) {
+// reportPanicOrClear shows a panic on the display, logging what the display
+// showed beforehand, or clears the display if there was no panic. screen points
+// to the last view known to be on the display.
+// heldLog holds log output while the terminal display is active.
+var heldLog holdingWriter
+
+// holdingWriter buffers up to maxHeldLog bytes until release, then writes them
+// to stderr. After release, it passes writes straight through.
+type holdingWriter struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	dropped  int
+	released bool
+}
+
+const maxHeldLog = 1 << 20
+
+func (w *holdingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.released {
+		return os.Stderr.Write(p)
+	}
+	if w.buf.Len()+len(p) > maxHeldLog {
+		w.dropped += len(p)
+		return len(p), nil
+	}
+	return w.buf.Write(p)
+}
+
+// release writes the held output to stderr.
+func (w *holdingWriter) release() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.released {
+		return
+	}
+	w.released = true
+	os.Stderr.Write(w.buf.Bytes())
+	if w.dropped > 0 {
+		fmt.Fprintf(os.Stderr, "(%d more bytes of log output dropped)\n", w.dropped)
+	}
+	w.buf = bytes.Buffer{}
+}
+
+func reportPanicOrClear(lcd display.Display, screen **view) {
 	if v := recover(); v != nil {
-		putWrapped(lcd, 0, 0, encode(fmt.Sprint("panic: ", v)))
+		if *screen != nil {
+			log.Printf("display before panic:\n%v", (*screen).LCD)
+		}
+		display.PutWrapped(lcd, 0, 0, encode(fmt.Sprint("panic: ", v)))
 		panic(v)
 	}
 	lcd.Clear()
 }
 
 func poll(mpd *mpd.Client, now time.Time, model *model) error {
+	prev := *model
+
 	cmds := mpd.BeginCommandList()
 	statusP := cmds.Status()
 	currentP := cmds.CurrentSong()
@@ -119,6 +237,45 @@ func poll(mpd *mpd.Client, now time.Time, model *model) error {
 		return err
 	}
 
+	// Single and consume modes can also be "oneshot".
+	model.Random = status["random"] == "1"
+	model.Repeat = status["repeat"] == "1"
+	model.Single = status["single"] != "0" && status["single"] != ""
+	model.Consume = status["consume"] != "0" && status["consume"] != ""
+
+	model.SongID = status["songid"]
+	model.Position = -1
+	if v, ok := status["song"]; ok {
+		if model.Position, err = strconv.Atoi(v); err != nil {
+			panic(err)
+		}
+	}
+	if model.QueueLength, err = strconv.Atoi(status["playlistlength"]); err != nil {
+		panic(err)
+	}
+	if status["nextsongid"] != model.NextSongID {
+		if err := pollNextTrack(mpd, status, model); err != nil {
+			return err
+		}
+	}
+
+	model.Bitrate = 0
+	if v, ok := status["bitrate"]; ok {
+		if model.Bitrate, err = strconv.Atoi(v); err != nil {
+			panic(err)
+		}
+	}
+	model.AudioFormat = status["audio"]
+	model.Error = status["error"]
+	_, model.UpdatingDB = status["updating_db"]
+
+	model.Volume = -1
+	if v, ok := status["volume"]; ok {
+		if model.Volume, err = strconv.Atoi(v); err != nil {
+			panic(err)
+		}
+	}
+
 	switch status["state"] {
 	case "stop":
 		update(&model.State, stopped, &model.LastStateChange, now)
@@ -139,6 +296,7 @@ func poll(mpd *mpd.Client, now time.Time, model *model) error {
 			panic(err)
 		}
 	}
+	model.LastElapsedUpdate = now
 
 	current, err := currentP.Value()
 	if err != nil {
@@ -148,9 +306,44 @@ func poll(mpd *mpd.Client, now time.Time, model *model) error {
 	update(&model.Track, current["Title"], &model.LastTrackInfoUpdate, now)
 	update(&model.Artist, current["Artist"], &model.LastTrackInfoUpdate, now)
 	update(&model.Album, current["Album"], &model.LastTrackInfoUpdate, now)
+
+	model.noticeChanges(&prev, now)
+	return nil
+}
+
+// pollNextTrack looks up the title of the song that follows the current one.
+func pollNextTrack(mpd *mpd.Client, status mpd.Attrs, model *model) error {
+	model.NextTrack = ""
+	if id := status["nextsongid"]; id != "" {
+		pos, err := strconv.Atoi(status["nextsong"])
+		if err != nil {
+			panic(err)
+		}
+		songs, err := mpd.PlaylistInfo(pos, -1)
+		if err != nil {
+			return err
+		}
+		if len(songs) > 0 {
+			model.NextTrack = songs[0]["Title"]
+		}
+	}
+	model.NextSongID = status["nextsongid"]
 	return nil
 }
 
+// elapsedAt extrapolates the time elapsed in the current track at now from the
+// time MPD last reported.
+func (m *model) elapsedAt(now time.Time) time.Duration {
+	e := m.Elapsed
+	if m.State == playing {
+		e += now.Sub(m.LastElapsedUpdate)
+	}
+	if e > m.Duration {
+		e = m.Duration
+	}
+	return e
+}
+
 func ellipsize(src []byte, ellipsis byte, dst []byte) {
 	if len(src) <= len(dst) {
 		copy(dst, src)
@@ -186,9 +379,21 @@ func fmtTime(t, max time.Duration) string {
 }
 
 func main() {
-	lcd := connectToCFA635()
-	defer reportPanicOrClear(lcd)
-	defer lcd.SetBacklight(0, 0)
+	flag.Parse()
+	c, err := loadConfig(*configFlag, flag.CommandLine)
+	if err != nil {
+		log.Fatal(err)
+	}
+	conf = c
+
+	// Release the held log output after the display closes, so that it
+	// lands on the restored terminal.
+	defer heldLog.release()
+	lcd := openDisplay()
+	defer lcd.Close()
+	var view1 *view
+	defer reportPanicOrClear(lcd, &view1)
+	defer lcd.SetBacklight(0)
 	if err := lcd.SetLED(0, false, 0); err != nil {
 		panic(err)
 	}
@@ -200,71 +405,105 @@ func main() {
 		panic(err)
 	}
 
-	mpd, err := mpd.Dial("unix", "/run/mpd/socket")
-	if err != nil {
-		panic(err)
-	}
+	// Learn about changes from MPD's idle notifications, and query MPD
+	// only when it reports them.
+	conn := newMPDConnection(conf.MPD.Network, conf.MPD.Address, conf.MPD.Password)
+	defer conn.close()
 
 	var model model
 
-	view1 := new(view)
-	view1.LCD = cfa635.ClearedLCDState()
+	glyphs := cfa635.NewGlyphManager()
+	cols, rows := lcd.Size()
+	view1 = new(view)
+	view1.LCD = display.NewFrame(cols, rows)
 	view1.Mtime = time.Now()
 
-	// Create an idle timer and put it in a drained state so the event loop
-	// can set it.
-	idle := time.NewTimer(0)
-	<-idle.C
+	// Create a timer and put it in a drained state so the event loop can
+	// set it.
+	wake := time.NewTimer(0)
+	<-wake.C
 
 	sigterm := make(chan os.Signal, 1)
 	signal.Notify(sigterm, os.Interrupt)
 
+	var keys <-chan *cfa635.GestureEvent
+	if k := lcd.Keys(); k != nil {
+		keys = cfa635.Gestures(keyActivity(k), gestureOptions()...)
+	}
+
+	sc := &screenContext{model: &model, conn: conn, glyphs: glyphs, cols: cols, rows: rows}
+	var fg screen
+
+	var polled time.Time // When the model last caught up with MPD
+	mpdChanged := true
+
 EventLoop:
 	for {
 		now := time.Now()
 
-		if err := poll(mpd, now, &model); err != nil {
-			panic(err)
+		if wantsMPD() && conn.connect(now) {
+			mpdChanged = true
 		}
-
-		var foreground2 foreground
-		if model.State == playing || now.Sub(model.LastStateChange).Seconds() < 17 {
-			foreground2 = mpdForeground
-		} else {
-			foreground2 = clockForeground
+		if conn.connected() && (mpdChanged || now.Sub(polled) >= mpdPollInterval) {
+			if err := poll(conn.client, now, &model); err != nil {
+				conn.drop(now, err)
+			} else {
+				polled = now
+				mpdChanged = false
+			}
 		}
 
-		if foreground2 != model.Foreground {
-			switch foreground2 {
-			case mpdForeground:
-				if err := initializeMPDDisplay(lcd); err != nil {
-					panic(err)
-				}
-			case clockForeground:
-				if err := initializeClockDisplay(lcd); err != nil {
-					panic(err)
-				}
+		sc.now = now
+		var foregroundChange time.Time
+		fg, foregroundChange = foreground(sc)
+		view2 := renderScreen(sc, fg, view1)
+		drawOverlay(sc, fg, view2)
+
+		// The CFA635 connection is supervised, so display errors are
+		// transient: the module restores the loaded sprites once it
+		// reconnects.
+		next := now.Add(retryDelay)
+		if err := updateView(lcd, glyphs, view1, view2); err != nil {
+			// Try again from the last view known to be on screen.
+			if err != cfa635.ErrDisconnected {
+				log.Print("failed to update display: ", err)
 			}
+		} else {
+			view1 = view2
+			next = earliest(view2.Next, foregroundChange)
 		}
-		model.Foreground = foreground2
-
-		var view2 *view
-		switch model.Foreground {
-		case mpdForeground:
-			view2 = mpdView(&model, now, view1)
-		case clockForeground:
-			view2 = clockView(now)
-		}
-		if err := updateView(lcd, view1, view2); err != nil {
-			panic(err)
+		if conn.connected() {
+			next = earliest(next, polled.Add(mpdPollInterval))
+		} else {
+			next = earliest(next, conn.retryAt)
 		}
-		view1 = view2
 
-		idle.Reset(10 * time.Millisecond)
+		// Sleep until the screen might change.
+		wake.Reset(time.Until(next))
 		select {
 		case <-sigterm:
 			break EventLoop
-		case <-idle.C:
+		case <-wake.C:
+		case <-conn.events():
+			mpdChanged = true
+			if !wake.Stop() {
+				<-wake.C
+			}
+		case e, ok := <-keys:
+			if !ok {
+				keys = nil
+			} else {
+				sc.now = e.Time
+				dispatchKey(sc, fg, e)
+			}
+			if !wake.Stop() {
+				<-wake.C
+			}
+		case err := <-conn.errors():
+			conn.drop(time.Now(), err)
+			if !wake.Stop() {
+				<-wake.C
+			}
 		}
 	}
 }
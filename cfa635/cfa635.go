@@ -33,27 +33,33 @@
 // 		panic(err)
 // 	}
 //
-// You can also use the State type and Update function to send the optimal
+// You can also use the State type and Update function to send the minimal
 // sequence of commands to the module to transform its state:
 //
-// 	if err := m.Reset(); err != nil {
+// 	s := cfa635.ClearedState()
+// 	s.Backlight = 100
+// 	s.Contrast = 95
+// 	copy(s.LCD[0][:], msg)
+// 	if err := cfa635.Update(m, nil, s); err != nil {
 // 		panic(err)
 // 	}
-// 	s := new(cfa635.State)
-// 	t := new(cfa635.State)
-// 	copy(t.LCD[0][0:19], msg)
-// 	if err := cfa635.Update(m, s, t); err != nil {
+// 	t := *s
+// 	t.LEDs[0][1] = 100 // Turn the top LED green.
+// 	if err := cfa635.Update(m, s, &t); err != nil {
 // 		panic(err)
 // 	}
-// 	s = t
+// 	s = &t
 package cfa635
 
 import (
 	"bufio"
+	"context"
+	"encoding/binary"
 	"errors"
 	"io"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -61,77 +67,290 @@ var (
 	ErrPayloadTooLarge = errors.New("payload too large")
 	ErrCGRAM           = errors.New("CGRAM index out of range")
 	ErrSprite          = errors.New("invalid sprite")
+	ErrAddress         = errors.New("LCD memory address out of range")
 	ErrPosition        = errors.New("position out of range")
+	ErrCursorStyle     = errors.New("unknown cursor style")
+	ErrContrast        = errors.New("contrast out of range")
 	ErrBacklight       = errors.New("backlight brightness out of range")
+	ErrFanMask         = errors.New("fan mask out of range")
+	ErrFanPower        = errors.New("fan power out of range")
+	ErrFailSafe        = errors.New("fan fail-safe timeout out of range")
+	ErrFanDelay        = errors.New("fan glitch filter delay out of range")
+	ErrDOWIndex        = errors.New("DOW device index out of range")
+	ErrKey             = errors.New("unknown key")
+	ErrATXFunction     = errors.New("invalid ATX power switch function")
+	ErrATXPulse        = errors.New("ATX power switch pulse length out of range")
+	ErrWatchdog        = errors.New("watchdog timeout out of range")
+	ErrBaudRate        = errors.New("unsupported baud rate")
+	ErrGPIOIndex       = errors.New("GPIO index out of range")
+	ErrGPIODuty        = errors.New("GPIO duty cycle out of range")
+	ErrGPIOMode        = errors.New("invalid GPIO drive mode")
 	ErrLEDIndex        = errors.New("LED index out of range")
 	ErrLEDDuty         = errors.New("LED duty cycle out of range")
 
-	ErrTimeout = errors.New("timed out")
+	ErrTimeout      = errors.New("timed out")
+	ErrDisconnected = errors.New("not connected to CFA635")
 
 	ErrFailed = errors.New("command failed")
 )
 
 // Module is a handle to a CFA635 module.
 type Module struct {
-	w         io.WriteCloser
-	reports   chan any    // Messages initiated by the CFA635
-	responses chan []byte // Responses to messages initiated by the host
+	stats DecoderStats // First, so atomic operations on it are 64-bit aligned
+
+	subs          subscriptions // Consumers of messages initiated by the CFA635
+	readReportSub *Subscription // Used by ReadReport
+
+	timeout time.Duration // Maximum response latency
+	retry   RetryPolicy
+	baud    int // Serial link speed, for Update's cost model
+
+	// Reopens the connection to the CFA635 after a failure; nil if the
+	// Module is not supervised
+	dial func() (io.ReadWriteCloser, error)
 
 	// Ensures that only one request is in flight to the CFA635 at once
-	mu sync.Mutex
+	busy chan struct{}
+
+	mu      sync.Mutex // Guards the fields below
+	link    *link      // Current connection; nil while disconnected
+	closed  bool
+	shadow  shadow
+	backoff time.Duration // Delay before the next reconnection attempt
+}
+
+// link is a single connection to a CFA635.
+type link struct {
+	rwc       io.ReadWriteCloser
+	responses chan []byte   // Responses to messages initiated by the host
+	dead      chan struct{} // Closed when the connection fails
+}
+
+// An Option configures a Module.
+type Option func(*Module)
+
+// WithTimeout sets how long the Module waits for the CFA635 to respond to a
+// command before giving up with ErrTimeout. The default is 250 ms.
+func WithTimeout(d time.Duration) Option {
+	return func(m *Module) { m.timeout = d }
+}
+
+// RetryPolicy controls how a Module retries idempotent commands (for example,
+// Put, SetBacklight, and SetLED) that time out.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times to send a command. Values
+	// less than 2 disable retries.
+	Attempts int
+
+	// Backoff is the delay before the first retry. Each subsequent retry
+	// waits twice as long as the last, up to MaxBackoff if it is nonzero.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// WithRetry sets the Module's retry policy. By default, a Module does not
+// retry commands.
+func WithRetry(p RetryPolicy) Option {
+	return func(m *Module) { m.retry = p }
+}
+
+// WithBaudRate tells the Module the baud rate of its serial link, which Update
+// uses to weigh the bytes it sends against the number of commands it sends. The
+// default is 115200. Rates that aren't positive are ignored.
+func WithBaudRate(baud int) Option {
+	return func(m *Module) {
+		if baud > 0 {
+			m.baud = baud
+		}
+	}
 }
 
 // Connect constructs a Module from a serial connection to a CFA635.
-func Connect(cfa635 io.ReadWriteCloser) *Module {
-	m := Module{w: cfa635, reports: make(chan any), responses: make(chan []byte)}
+func Connect(cfa635 io.ReadWriteCloser, opts ...Option) *Module {
+	m := newModule(opts)
+	m.mu.Lock()
+	m.link = m.attach(cfa635)
+	m.mu.Unlock()
+	return m
+}
+
+func newModule(opts []Option) *Module {
+	m := &Module{
+		subs:    newSubscriptions(),
+		timeout: timeout,
+		baud:    115200,
+		busy:    make(chan struct{}, 1),
+		shadow:  newShadow(),
+		backoff: minReconnectBackoff,
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	m.readReportSub = m.Subscribe(reportBuffer)
+	return m
+}
+
+// attach starts reading packets from a new connection to the CFA635. When the
+// connection fails, the returned link dies and the Module detaches it.
+func (m *Module) attach(rwc io.ReadWriteCloser) *link {
+	l := &link{rwc: rwc, responses: make(chan []byte, 1), dead: make(chan struct{})}
 
 	bytes := make(chan byte)
-	go buffer(bufio.NewReader(cfa635), bytes)
+	go buffer(bufio.NewReader(rwc), bytes)
 	packets := make(chan []byte)
-	go decode(bytes, packets)
-	go route(packets, m.reports, m.responses)
+	go decode(bytes, packets, &m.stats)
+	go func() {
+		route(packets, m.subs.publish, l.responses)
+		close(l.dead)
+		m.detach(l)
+	}()
+
+	return l
+}
 
-	return &m
+// detach forgets a dead link. If the Module is supervised and still open, it
+// starts reconnecting; otherwise, it ends all report subscriptions.
+func (m *Module) detach(l *link) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l.rwc.Close()
+	if m.link == l {
+		m.link = nil
+	}
+	if m.dial == nil || m.closed {
+		m.subs.close()
+		return
+	}
+	go m.reconnect()
 }
 
 // Close releases the CFA635 and closes the underlying connection.
-func (m *Module) Close() { m.w.Close() }
+func (m *Module) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	if m.link != nil {
+		m.link.rwc.Close()
+	}
+}
 
 // ReadReport blocks until the CFA635 sends a report to the host and then
-// returns it. The returned report will be a *KeyActivity, *FanSpeed, or
-// *Temperature.
-func (m *Module) ReadReport() any { return <-m.reports }
+// returns it, or returns nil once the Module has closed. ReadReport buffers a
+// few reports; if they are not read promptly, later ones are dropped. To
+// receive reports in more than one goroutine, use Subscribe instead.
+func (m *Module) ReadReport() Report { return <-m.readReportSub.C }
+
+// DecoderStats returns counts of the bytes and frames the Module has discarded
+// while reassembling packets from the CFA635.
+func (m *Module) DecoderStats() DecoderStats {
+	return DecoderStats{
+		DroppedBytes: atomic.LoadUint64(&m.stats.DroppedBytes),
+		BadFrames:    atomic.LoadUint64(&m.stats.BadFrames),
+	}
+}
 
 // RawCommand sends an arbitrary command (request and payload) to the CFA635,
-// returning the response (and payload) or error.
+// returning the response (and payload) or error. RawCommand never retries.
 func (m *Module) RawCommand(req byte, reqP []byte) (resp byte, respP []byte, err error) {
+	return m.RawCommandContext(context.Background(), req, reqP)
+}
+
+// RawCommandContext is like RawCommand, but it gives up with ctx.Err() if ctx
+// is done before the CFA635 responds.
+func (m *Module) RawCommandContext(ctx context.Context, req byte, reqP []byte) (resp byte, respP []byte, err error) {
+	select {
+	case m.busy <- struct{}{}:
+		defer func() { <-m.busy }()
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+
+	m.mu.Lock()
+	l := m.link
+	m.mu.Unlock()
+	if l == nil {
+		return 0, nil, ErrDisconnected
+	}
+	return m.roundTrip(ctx, l, req, reqP)
+}
+
+// roundTrip sends a command over a link and waits for the response. The caller
+// must hold m.busy.
+func (m *Module) roundTrip(ctx context.Context, l *link, req byte, reqP []byte) (resp byte, respP []byte, err error) {
 	p := []byte{req, byte(len(reqP))}
 	p = append(p, reqP...)
 	p = pushCRC(p)
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if _, err := m.w.Write(p); err != nil {
+	if _, err := l.rwc.Write(p); err != nil {
+		// Make sure the reader notices the failure, too.
+		l.rwc.Close()
 		return 0, nil, err
 	}
 
-	var q []byte
-	select {
-	case q = <-m.responses:
-		break
-	case <-time.After(timeout):
-		return 0, nil, ErrTimeout
+	timedout := time.NewTimer(m.timeout)
+	defer timedout.Stop()
+	for {
+		var q []byte
+		select {
+		case q = <-l.responses:
+		case <-l.dead:
+			return 0, nil, ErrDisconnected
+		case <-timedout.C:
+			return 0, nil, ErrTimeout
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		}
+
+		if len(q) < 2 || len(q) != 2+int(q[1]) {
+			return 0, nil, ErrFailed
+		}
+		if q[0]&0b0011_1111 != req {
+			// This is a late response to an earlier command that
+			// timed out.
+			continue
+		}
+		return q[0], q[2:], nil
 	}
+}
 
-	if len(q) < 2 || len(q) != 2+int(q[1]) {
-		return 0, nil, ErrFailed
+// idempotent reports whether sending a command twice has the same effect as
+// sending it once.
+func idempotent(req byte) bool {
+	switch req {
+	case 0x00, 0x01, 0x03, 0x06, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x10, 0x11,
+		0x12, 0x13, 0x17, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1f, 0x22:
+		return true
+	default:
+		return false
 	}
+}
+
+// command is like RawCommandContext, but it retries idempotent commands that
+// time out according to the Module's retry policy.
+func (m *Module) command(ctx context.Context, req byte, reqP []byte) (resp byte, respP []byte, err error) {
+	backoff := m.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		resp, respP, err = m.RawCommandContext(ctx, req, reqP)
+		if err != ErrTimeout || attempt >= m.retry.Attempts || !idempotent(req) {
+			return
+		}
 
-	return q[0], q[2:], nil
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return 0, nil, ctx.Err()
+		}
+		backoff *= 2
+		if m.retry.MaxBackoff != 0 && backoff > m.retry.MaxBackoff {
+			backoff = m.retry.MaxBackoff
+		}
+	}
 }
 
-func (m *Module) simple(req byte, reqP []byte, wantC byte, wantP []byte) error {
-	gotC, gotP, err := m.RawCommand(req, reqP)
+func (m *Module) simple(ctx context.Context, req byte, reqP []byte, wantC byte, wantP []byte) error {
+	gotC, gotP, err := m.command(ctx, req, reqP)
 	if err != nil {
 		return err
 	}
@@ -144,17 +363,132 @@ func (m *Module) simple(req byte, reqP []byte, wantC byte, wantP []byte) error {
 	return nil
 }
 
+// query sends a command whose response carries a payload of a fixed length and
+// returns that payload.
+func (m *Module) query(ctx context.Context, req byte, reqP []byte, wantC byte, wantLen int) ([]byte, error) {
+	gotC, gotP, err := m.command(ctx, req, reqP)
+	if err != nil {
+		return nil, err
+	}
+	if gotC != wantC || len(gotP) != wantLen {
+		return nil, ErrFailed
+	}
+	return gotP, nil
+}
+
 // Ping pings the CFA635 with a payload of up to 16 bytes.
 func (m *Module) Ping(payload []byte) error {
+	return m.PingContext(context.Background(), payload)
+}
+
+// PingContext is like Ping, but it gives up with ctx.Err() if ctx is done
+// before the CFA635 responds.
+func (m *Module) PingContext(ctx context.Context, payload []byte) error {
 	if len(payload) > 16 {
 		return ErrPayloadTooLarge
 	}
-	return m.simple(0x00, payload, 0x40, payload)
+	return m.simple(ctx, 0x00, payload, 0x40, payload)
+}
+
+// Version returns the CFA635's hardware and firmware version string, which has
+// the form "CFA635:hX.X,yY.Y".
+func (m *Module) Version() (string, error) {
+	return m.VersionContext(context.Background())
+}
+
+// VersionContext is like Version, but it gives up with ctx.Err() if ctx is done
+// before the CFA635 responds.
+func (m *Module) VersionContext(ctx context.Context) (string, error) {
+	v, err := m.query(ctx, 0x01, nil, 0x41, 16)
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// WriteUserFlash stores 16 bytes of arbitrary data in the CFA635's
+// nonvolatile user flash area.
+func (m *Module) WriteUserFlash(data *[16]byte) error {
+	return m.WriteUserFlashContext(context.Background(), data)
+}
+
+// WriteUserFlashContext is like WriteUserFlash, but it gives up with ctx.Err()
+// if ctx is done before the CFA635 responds.
+func (m *Module) WriteUserFlashContext(ctx context.Context, data *[16]byte) error {
+	return m.simple(ctx, 0x02, data[:], 0x42, nil)
+}
+
+// ReadUserFlash returns the contents of the CFA635's user flash area.
+func (m *Module) ReadUserFlash() (*[16]byte, error) {
+	return m.ReadUserFlashContext(context.Background())
+}
+
+// ReadUserFlashContext is like ReadUserFlash, but it gives up with ctx.Err() if
+// ctx is done before the CFA635 responds.
+func (m *Module) ReadUserFlashContext(ctx context.Context) (*[16]byte, error) {
+	p, err := m.query(ctx, 0x03, nil, 0x43, 16)
+	if err != nil {
+		return nil, err
+	}
+	var r [16]byte
+	copy(r[:], p)
+	return &r, nil
+}
+
+// StoreBootState saves the current state of the CFA635 (LCD contents, special
+// characters, cursor, contrast, backlight, reporting, fan, ATX, watchdog, baud
+// rate, and GPIO settings) so that the module restores it when it powers on.
+func (m *Module) StoreBootState() error {
+	return m.StoreBootStateContext(context.Background())
+}
+
+// StoreBootStateContext is like StoreBootState, but it gives up with ctx.Err()
+// if ctx is done before the CFA635 responds.
+func (m *Module) StoreBootStateContext(ctx context.Context) error {
+	return m.simple(ctx, 0x04, nil, 0x44, nil)
+}
+
+// Reboot restarts the CFA635 in its boot state.
+func (m *Module) Reboot() error { return m.RebootContext(context.Background()) }
+
+// RebootContext is like Reboot, but it gives up with ctx.Err() if ctx is done
+// before the CFA635 responds.
+func (m *Module) RebootContext(ctx context.Context) error {
+	return m.simple(ctx, 0x05, []byte{8, 18, 99}, 0x45, nil)
+}
+
+// ResetHost pulses the host's reset line through the CFA635's ATX connection.
+func (m *Module) ResetHost() error {
+	return m.ResetHostContext(context.Background())
+}
+
+// ResetHostContext is like ResetHost, but it gives up with ctx.Err() if ctx is
+// done before the CFA635 responds.
+func (m *Module) ResetHostContext(ctx context.Context) error {
+	return m.simple(ctx, 0x05, []byte{12, 28, 97}, 0x45, nil)
+}
+
+// PowerOffHost turns the host off through the CFA635's ATX connection.
+func (m *Module) PowerOffHost() error {
+	return m.PowerOffHostContext(context.Background())
+}
+
+// PowerOffHostContext is like PowerOffHost, but it gives up with ctx.Err() if
+// ctx is done before the CFA635 responds.
+func (m *Module) PowerOffHostContext(ctx context.Context) error {
+	return m.simple(ctx, 0x05, []byte{3, 11, 95}, 0x45, nil)
 }
 
 // Clear clears the CFA635 LCD. After Clear returns successfully, all LCD cells
 // hold 0x20 (space).
-func (m *Module) Clear() error { return m.simple(0x06, nil, 0x46, nil) }
+func (m *Module) Clear() error { return m.ClearContext(context.Background()) }
+
+// ClearContext is like Clear, but it gives up with ctx.Err() if ctx is done
+// before the CFA635 responds.
+func (m *Module) ClearContext(ctx context.Context) error {
+	m.remember(func(s *shadow) { s.lcd = *ClearedLCDState() })
+	return m.simple(ctx, 0x06, nil, 0x46, nil)
+}
 
 // SetCharacter sets a sprite (six columns by eight rows) in character generator
 // RAM. The index of the sprite must be between 0 and 7, inclusive.
@@ -164,6 +498,12 @@ func (m *Module) Clear() error { return m.simple(0x06, nil, 0x46, nil) }
 // determine the six pixels in the row, with 1 bits corresponding to active
 // pixels and 0 bits corresponding to inactive ones.
 func (m *Module) SetCharacter(i int, data *[8]byte) error {
+	return m.SetCharacterContext(context.Background(), i, data)
+}
+
+// SetCharacterContext is like SetCharacter, but it gives up with ctx.Err() if
+// ctx is done before the CFA635 responds.
+func (m *Module) SetCharacterContext(ctx context.Context, i int, data *[8]byte) error {
 	if i < 0 || i > 7 {
 		return ErrCGRAM
 	}
@@ -175,24 +515,365 @@ func (m *Module) SetCharacter(i int, data *[8]byte) error {
 
 	payload := []byte{byte(i)}
 	payload = append(payload, data[:]...)
-	return m.simple(0x09, payload, 0x49, nil)
+	m.remember(func(s *shadow) {
+		s.cgram[i] = *data
+		s.cgramSet |= 1 << i
+	})
+	return m.simple(ctx, 0x09, payload, 0x49, nil)
+}
+
+// ReadLCDMemory reads eight bytes from the LCD controller, starting at an
+// address between 0x40 and 0xe7, inclusive. Addresses 0x40 through 0x7f are
+// character generator RAM; addresses from 0x80 up are display data RAM.
+func (m *Module) ReadLCDMemory(addr int) (*[8]byte, error) {
+	return m.ReadLCDMemoryContext(context.Background(), addr)
+}
+
+// ReadLCDMemoryContext is like ReadLCDMemory, but it gives up with ctx.Err() if
+// ctx is done before the CFA635 responds.
+func (m *Module) ReadLCDMemoryContext(ctx context.Context, addr int) (*[8]byte, error) {
+	if addr < 0x40 || addr > 0xe7 {
+		return nil, ErrAddress
+	}
+	p, err := m.query(ctx, 0x0a, []byte{byte(addr)}, 0x4a, 9)
+	if err != nil {
+		return nil, err
+	}
+	if p[0] != byte(addr) {
+		return nil, ErrFailed
+	}
+	var r [8]byte
+	copy(r[:], p[1:])
+	return &r, nil
+}
+
+// SetCursorPosition moves the LCD cursor to a row and column.
+func (m *Module) SetCursorPosition(col, row int) error {
+	return m.SetCursorPositionContext(context.Background(), col, row)
+}
+
+// SetCursorPositionContext is like SetCursorPosition, but it gives up with
+// ctx.Err() if ctx is done before the CFA635 responds.
+func (m *Module) SetCursorPositionContext(ctx context.Context, col, row int) error {
+	if col < 0 || col >= 20 || row < 0 || row >= 4 {
+		return ErrPosition
+	}
+	return m.simple(ctx, 0x0b, []byte{byte(col), byte(row)}, 0x4b, nil)
+}
+
+// CursorStyle is the appearance of the LCD cursor.
+type CursorStyle int
+
+const (
+	NoCursor CursorStyle = iota
+	BlinkingBlockCursor
+	UnderscoreCursor
+	BlinkingBlockUnderscoreCursor
+	InvertingBlinkingBlockCursor
+)
+
+// SetCursorStyle controls the appearance of the LCD cursor.
+func (m *Module) SetCursorStyle(s CursorStyle) error {
+	return m.SetCursorStyleContext(context.Background(), s)
+}
+
+// SetCursorStyleContext is like SetCursorStyle, but it gives up with ctx.Err()
+// if ctx is done before the CFA635 responds.
+func (m *Module) SetCursorStyleContext(ctx context.Context, s CursorStyle) error {
+	if s < NoCursor || s > InvertingBlinkingBlockCursor {
+		return ErrCursorStyle
+	}
+	return m.simple(ctx, 0x0c, []byte{byte(s)}, 0x4c, nil)
+}
+
+// SetContrast sets the LCD contrast, from 0 (light) to 254 (dark), inclusive.
+func (m *Module) SetContrast(contrast int) error {
+	return m.SetContrastContext(context.Background(), contrast)
+}
+
+// SetContrastContext is like SetContrast, but it gives up with ctx.Err() if ctx
+// is done before the CFA635 responds.
+func (m *Module) SetContrastContext(ctx context.Context, contrast int) error {
+	if contrast < 0 || contrast > 254 {
+		return ErrContrast
+	}
+	return m.simple(ctx, 0x0d, []byte{byte(contrast)}, 0x4d, nil)
 }
 
 // SetBacklight controls the LEDs backing the LCD and keypad. Each LED value can
 // range from 0 to 100, inclusive, with 0 turning off the light and 100 turning
 // it on to its maximum brightness.
 func (m *Module) SetBacklight(lcd, keypad int) error {
+	return m.SetBacklightContext(context.Background(), lcd, keypad)
+}
+
+// SetBacklightContext is like SetBacklight, but it gives up with ctx.Err() if
+// ctx is done before the CFA635 responds.
+func (m *Module) SetBacklightContext(ctx context.Context, lcd, keypad int) error {
 	if lcd < 0 || lcd > 100 || keypad < 0 || keypad > 100 {
 		return ErrBacklight
 	}
+	m.remember(func(s *shadow) {
+		s.backlight = [2]int{lcd, keypad}
+		s.backlightSet = true
+	})
+
+	return m.simple(ctx, 0x0e, []byte{byte(lcd), byte(keypad)}, 0x4e, nil)
+}
+
+// SetFanReporting controls which of the four fans the CFA635 sends FanSpeed
+// reports for. Bit i of the mask enables reporting for fan i.
+func (m *Module) SetFanReporting(mask int) error {
+	return m.SetFanReportingContext(context.Background(), mask)
+}
+
+// SetFanReportingContext is like SetFanReporting, but it gives up with
+// ctx.Err() if ctx is done before the CFA635 responds.
+func (m *Module) SetFanReportingContext(ctx context.Context, mask int) error {
+	if mask < 0 || mask > 0b1111 {
+		return ErrFanMask
+	}
+	return m.simple(ctx, 0x10, []byte{byte(mask)}, 0x50, nil)
+}
+
+// SetFanPower sets the power of each of the four fans to a value from 0 (off)
+// to 100 (full power), inclusive.
+func (m *Module) SetFanPower(power *[4]int) error {
+	return m.SetFanPowerContext(context.Background(), power)
+}
+
+// SetFanPowerContext is like SetFanPower, but it gives up with ctx.Err() if ctx
+// is done before the CFA635 responds.
+func (m *Module) SetFanPowerContext(ctx context.Context, power *[4]int) error {
+	p := make([]byte, len(power))
+	for i, w := range power {
+		if w < 0 || w > 100 {
+			return ErrFanPower
+		}
+		p[i] = byte(w)
+	}
+	return m.simple(ctx, 0x11, p, 0x51, nil)
+}
+
+// ReadDOWDeviceInfo returns the 64-bit ROM ID of one of the 32 Dallas One-Wire
+// devices the CFA635 can address. A device that is not connected has an ID of
+// all zeros.
+func (m *Module) ReadDOWDeviceInfo(i int) (*[8]byte, error) {
+	return m.ReadDOWDeviceInfoContext(context.Background(), i)
+}
+
+// ReadDOWDeviceInfoContext is like ReadDOWDeviceInfo, but it gives up with
+// ctx.Err() if ctx is done before the CFA635 responds.
+func (m *Module) ReadDOWDeviceInfoContext(ctx context.Context, i int) (*[8]byte, error) {
+	if i < 0 || i > 31 {
+		return nil, ErrDOWIndex
+	}
+	p, err := m.query(ctx, 0x12, []byte{byte(i)}, 0x52, 9)
+	if err != nil {
+		return nil, err
+	}
+	if p[0] != byte(i) {
+		return nil, ErrFailed
+	}
+	var r [8]byte
+	copy(r[:], p[1:])
+	return &r, nil
+}
+
+// SetTemperatureReporting controls which of the 32 temperature sensors the
+// CFA635 sends Temperature reports for. Bit i of the mask enables reporting for
+// sensor i.
+func (m *Module) SetTemperatureReporting(mask uint32) error {
+	return m.SetTemperatureReportingContext(context.Background(), mask)
+}
+
+// SetTemperatureReportingContext is like SetTemperatureReporting, but it gives
+// up with ctx.Err() if ctx is done before the CFA635 responds.
+func (m *Module) SetTemperatureReportingContext(ctx context.Context, mask uint32) error {
+	p := make([]byte, 4)
+	binary.LittleEndian.PutUint32(p, mask)
+	return m.simple(ctx, 0x13, p, 0x53, nil)
+}
+
+// WriteLCDController sends a byte directly to the LCD controller's instruction
+// register or, if data is true, to its data register.
+func (m *Module) WriteLCDController(data bool, b byte) error {
+	return m.WriteLCDControllerContext(context.Background(), data, b)
+}
+
+// WriteLCDControllerContext is like WriteLCDController, but it gives up with
+// ctx.Err() if ctx is done before the CFA635 responds.
+func (m *Module) WriteLCDControllerContext(ctx context.Context, data bool, b byte) error {
+	var reg byte
+	if data {
+		reg = 1
+	}
+	return m.simple(ctx, 0x16, []byte{reg, b}, 0x56, nil)
+}
+
+// ConfigureKeyReporting controls which keys the CFA635 sends KeyActivity
+// reports for, separately for presses and releases.
+func (m *Module) ConfigureKeyReporting(press, release []Key) error {
+	return m.ConfigureKeyReportingContext(context.Background(), press, release)
+}
+
+// ConfigureKeyReportingContext is like ConfigureKeyReporting, but it gives up
+// with ctx.Err() if ctx is done before the CFA635 responds.
+func (m *Module) ConfigureKeyReportingContext(ctx context.Context, press, release []Key) error {
+	pm, err := keyMask(press)
+	if err != nil {
+		return err
+	}
+	rm, err := keyMask(release)
+	if err != nil {
+		return err
+	}
+	return m.simple(ctx, 0x17, []byte{pm, rm}, 0x57, nil)
+}
+
+// KeypadState is the result of polling the keypad.
+type KeypadState struct {
+	Pressed               []Key // Keys down at the time of the poll
+	PressedSinceLastPoll  []Key
+	ReleasedSinceLastPoll []Key
+}
+
+// ReadKeypad polls the keypad. Polling works whether or not key reporting is
+// enabled.
+func (m *Module) ReadKeypad() (*KeypadState, error) {
+	return m.ReadKeypadContext(context.Background())
+}
+
+// ReadKeypadContext is like ReadKeypad, but it gives up with ctx.Err() if ctx
+// is done before the CFA635 responds.
+func (m *Module) ReadKeypadContext(ctx context.Context) (*KeypadState, error) {
+	p, err := m.query(ctx, 0x18, nil, 0x58, 3)
+	if err != nil {
+		return nil, err
+	}
+	return &KeypadState{maskKeys(p[0]), maskKeys(p[1]), maskKeys(p[2])}, nil
+}
+
+// SetFanFailSafe arranges for the fans selected by mask (bit i selecting fan
+// i) to run at full power if the host does not set their power within a
+// timeout, specified in eighths of a second between 1 and 255, inclusive.
+func (m *Module) SetFanFailSafe(mask, timeout int) error {
+	return m.SetFanFailSafeContext(context.Background(), mask, timeout)
+}
+
+// SetFanFailSafeContext is like SetFanFailSafe, but it gives up with ctx.Err()
+// if ctx is done before the CFA635 responds.
+func (m *Module) SetFanFailSafeContext(ctx context.Context, mask, timeout int) error {
+	if mask < 0 || mask > 0b1111 {
+		return ErrFanMask
+	}
+	if timeout < 1 || timeout > 255 {
+		return ErrFailSafe
+	}
+	return m.simple(ctx, 0x19, []byte{byte(mask), byte(timeout)}, 0x59, nil)
+}
+
+// SetFanGlitchFilter sets, for each fan, the delay (in eighths of a second,
+// between 0 and 255, inclusive) after a power change during which the CFA635
+// ignores the fan's tachometer.
+func (m *Module) SetFanGlitchFilter(delay *[4]int) error {
+	return m.SetFanGlitchFilterContext(context.Background(), delay)
+}
+
+// SetFanGlitchFilterContext is like SetFanGlitchFilter, but it gives up with
+// ctx.Err() if ctx is done before the CFA635 responds.
+func (m *Module) SetFanGlitchFilterContext(ctx context.Context, delay *[4]int) error {
+	p := make([]byte, len(delay))
+	for i, d := range delay {
+		if d < 0 || d > 255 {
+			return ErrFanDelay
+		}
+		p[i] = byte(d)
+	}
+	return m.simple(ctx, 0x1a, p, 0x5a, nil)
+}
+
+// FanPower returns the power of each of the four fans, along with the mask of
+// fans in fail-safe mode (see SetFanFailSafe).
+func (m *Module) FanPower() (power [4]int, failSafe int, err error) {
+	return m.FanPowerContext(context.Background())
+}
 
-	return m.simple(0x0e, []byte{byte(lcd), byte(keypad)}, 0x4e, nil)
+// FanPowerContext is like FanPower, but it gives up with ctx.Err() if ctx is
+// done before the CFA635 responds.
+func (m *Module) FanPowerContext(ctx context.Context) (power [4]int, failSafe int, err error) {
+	p, err := m.query(ctx, 0x1b, nil, 0x5b, 5)
+	if err != nil {
+		return power, 0, err
+	}
+	for i := range power {
+		power[i] = int(p[i])
+	}
+	return power, int(p[4]), nil
+}
+
+// ATXFunction is a set of features of the CFA635's ATX power switch
+// connection.
+type ATXFunction byte
+
+const (
+	ATXKeypadReset     ATXFunction = 0x08 // Holding the green check key resets the host
+	ATXKeypadPowerOn   ATXFunction = 0x10 // Any key turns on a host that is off
+	ATXKeypadPowerOff  ATXFunction = 0x20 // Holding the red X key turns off the host
+	ATXLCDOffIfHostOff ATXFunction = 0x40 // The display blanks when the host is off
+	ATXAutoPolarity    ATXFunction = 0x80 // The power sense line may be inverted
+)
+
+// SetATXPowerSwitch configures the ATX power switch connection. The pulse
+// length sent to the host's power switch is specified in 32nds of a second
+// between 1 and 255, inclusive, or 0 for the default of one second.
+func (m *Module) SetATXPowerSwitch(f ATXFunction, pulse int) error {
+	return m.SetATXPowerSwitchContext(context.Background(), f, pulse)
+}
+
+// SetATXPowerSwitchContext is like SetATXPowerSwitch, but it gives up with
+// ctx.Err() if ctx is done before the CFA635 responds.
+func (m *Module) SetATXPowerSwitchContext(ctx context.Context, f ATXFunction, pulse int) error {
+	if f&0b0000_0111 != 0 {
+		return ErrATXFunction
+	}
+	if pulse < 0 || pulse > 255 {
+		return ErrATXPulse
+	}
+	p := []byte{byte(f)}
+	if pulse != 0 {
+		p = append(p, byte(pulse))
+	}
+	return m.simple(ctx, 0x1c, p, 0x5c, nil)
+}
+
+// SetWatchdog enables the host watchdog with a timeout between 1 and 255
+// seconds, inclusive, or disables it if the timeout is 0. Once enabled, the
+// host must call SetWatchdog again before the timeout expires, or the CFA635
+// will reset the host.
+func (m *Module) SetWatchdog(timeout int) error {
+	return m.SetWatchdogContext(context.Background(), timeout)
+}
+
+// SetWatchdogContext is like SetWatchdog, but it gives up with ctx.Err() if ctx
+// is done before the CFA635 responds.
+func (m *Module) SetWatchdogContext(ctx context.Context, timeout int) error {
+	if timeout < 0 || timeout > 255 {
+		return ErrWatchdog
+	}
+	return m.simple(ctx, 0x1d, []byte{byte(timeout)}, 0x5d, nil)
 }
 
 // Put writes data to the LCD at a row and column. No wrapping occurs; if the
 // data are too large, they are truncated. Data are interpreted in the CFA635
 // character set; see NewEncoder.
 func (m *Module) Put(col, row int, data []byte) error {
+	return m.PutContext(context.Background(), col, row, data)
+}
+
+// PutContext is like Put, but it gives up with ctx.Err() if ctx is done before
+// the CFA635 responds.
+func (m *Module) PutContext(ctx context.Context, col, row int, data []byte) error {
 	if col < 0 || col >= 20 || row < 0 || row >= 4 {
 		return ErrPosition
 	}
@@ -203,7 +884,112 @@ func (m *Module) Put(col, row int, data []byte) error {
 
 	payload := []byte{byte(col), byte(row)}
 	payload = append(payload, data...)
-	return m.simple(0x1f, payload, 0x5f, nil)
+	m.remember(func(s *shadow) { copy(s.lcd[row][col:], data) })
+	return m.simple(ctx, 0x1f, payload, 0x5f, nil)
+}
+
+// SetBaudRate changes the speed of the CFA635's serial port to 19200 or 115200
+// baud. The CFA635 acknowledges the command at the old rate; the caller must
+// then reconfigure its own side of the connection.
+func (m *Module) SetBaudRate(baud int) error {
+	return m.SetBaudRateContext(context.Background(), baud)
+}
+
+// SetBaudRateContext is like SetBaudRate, but it gives up with ctx.Err() if ctx
+// is done before the CFA635 responds.
+func (m *Module) SetBaudRateContext(ctx context.Context, baud int) error {
+	var b byte
+	switch baud {
+	case 19200:
+		b = 0
+	case 115200:
+		b = 1
+	default:
+		return ErrBaudRate
+	}
+	return m.simple(ctx, 0x21, []byte{b}, 0x61, nil)
+}
+
+// GPIOMode is the drive mode and function of a GPIO pin. Bits 0 through 2
+// select the drive mode, and bit 3 selects between user (0) and system (1)
+// control; see the CFA635 data sheet for details.
+type GPIOMode byte
+
+// SetGPIO sets one of the 13 GPIO pins to a duty cycle between 0 and 100,
+// inclusive. Pins 5 through 12 drive the LEDs; see SetLED.
+func (m *Module) SetGPIO(pin, duty int) error {
+	return m.SetGPIOContext(context.Background(), pin, duty)
+}
+
+// SetGPIOContext is like SetGPIO, but it gives up with ctx.Err() if ctx is done
+// before the CFA635 responds.
+func (m *Module) SetGPIOContext(ctx context.Context, pin, duty int) error {
+	if pin < 0 || pin > 12 {
+		return ErrGPIOIndex
+	}
+	if duty < 0 || duty > 100 {
+		return ErrGPIODuty
+	}
+	m.remember(func(s *shadow) { s.setGPIO(pin, duty) })
+	return m.simple(ctx, 0x22, []byte{byte(pin), byte(duty)}, 0x62, nil)
+}
+
+// ConfigureGPIO sets one of the 13 GPIO pins to a duty cycle and changes its
+// drive mode.
+func (m *Module) ConfigureGPIO(pin, duty int, mode GPIOMode) error {
+	return m.ConfigureGPIOContext(context.Background(), pin, duty, mode)
+}
+
+// ConfigureGPIOContext is like ConfigureGPIO, but it gives up with ctx.Err() if
+// ctx is done before the CFA635 responds.
+func (m *Module) ConfigureGPIOContext(ctx context.Context, pin, duty int, mode GPIOMode) error {
+	if pin < 0 || pin > 12 {
+		return ErrGPIOIndex
+	}
+	if duty < 0 || duty > 100 {
+		return ErrGPIODuty
+	}
+	if mode > 0b1111 {
+		return ErrGPIOMode
+	}
+	m.remember(func(s *shadow) { s.configureGPIO(pin, duty, mode) })
+	return m.simple(ctx, 0x22, []byte{byte(pin), byte(duty), byte(mode)}, 0x62, nil)
+}
+
+// GPIOState is the state of a GPIO pin.
+type GPIOState struct {
+	High      bool // Current level of the pin
+	RoseSince bool // Whether the pin went high since the last read
+	FellSince bool // Whether the pin went low since the last read
+	Duty      int  // Requested duty cycle
+	Mode      GPIOMode
+}
+
+// ReadGPIO reads the state of one of the 13 GPIO pins.
+func (m *Module) ReadGPIO(pin int) (*GPIOState, error) {
+	return m.ReadGPIOContext(context.Background(), pin)
+}
+
+// ReadGPIOContext is like ReadGPIO, but it gives up with ctx.Err() if ctx is
+// done before the CFA635 responds.
+func (m *Module) ReadGPIOContext(ctx context.Context, pin int) (*GPIOState, error) {
+	if pin < 0 || pin > 12 {
+		return nil, ErrGPIOIndex
+	}
+	p, err := m.query(ctx, 0x23, []byte{byte(pin)}, 0x63, 4)
+	if err != nil {
+		return nil, err
+	}
+	if p[0] != byte(pin) {
+		return nil, ErrFailed
+	}
+	return &GPIOState{
+		High:      p[1]&0b001 != 0,
+		RoseSince: p[1]&0b010 != 0,
+		FellSince: p[1]&0b100 != 0,
+		Duty:      int(p[2]),
+		Mode:      GPIOMode(p[3]),
+	}, nil
 }
 
 // SetLED controls the four red/green LEDs to the left of the LCD. The LEDs are
@@ -211,6 +997,12 @@ func (m *Module) Put(col, row int, data []byte) error {
 // components can be set separately to a value from 0 (off) to 100 (full duty
 // cycle).
 func (m *Module) SetLED(led int, green bool, duty int) error {
+	return m.SetLEDContext(context.Background(), led, green, duty)
+}
+
+// SetLEDContext is like SetLED, but it gives up with ctx.Err() if ctx is done
+// before the CFA635 responds.
+func (m *Module) SetLEDContext(ctx context.Context, led int, green bool, duty int) error {
 	if led < 0 || led > 3 {
 		return ErrLEDIndex
 	}
@@ -222,5 +1014,6 @@ func (m *Module) SetLED(led int, green bool, duty int) error {
 	if !green {
 		i++
 	}
-	return m.simple(0x22, []byte{i, byte(duty)}, 0x62, nil)
+	m.remember(func(s *shadow) { s.setGPIO(int(i), duty) })
+	return m.simple(ctx, 0x22, []byte{i, byte(duty)}, 0x62, nil)
 }
@@ -0,0 +1,87 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/cfa635/cfa635test"
+)
+
+// retrying connects to a new Emulator with a short timeout and the given retry
+// policy.
+func retrying(t *testing.T, p cfa635.RetryPolicy) (*cfa635.Module, *cfa635test.Emulator) {
+	e := cfa635test.NewEmulator()
+	m := cfa635.Connect(e, cfa635.WithTimeout(20*time.Millisecond), cfa635.WithRetry(p))
+	t.Cleanup(func() { m.Close() })
+	return m, e
+}
+
+func TestRetryAfterDroppedResponse(t *testing.T) {
+	m, e := retrying(t, cfa635.RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+
+	e.DropResponses(2)
+	if err := m.Put(0, 0, []byte("Hello")); err != nil {
+		t.Fatalf("Put with two dropped responses: %v", err)
+	}
+	if got := e.LCD(); string(got[0][:5]) != "Hello" {
+		t.Errorf("row 0 = %q, want Hello", got[0])
+	}
+
+	e.DropResponses(3)
+	if err := m.Put(0, 1, []byte("Lost")); err != cfa635.ErrTimeout {
+		t.Errorf("Put with every response dropped returned %v, want ErrTimeout", err)
+	}
+}
+
+func TestNoRetryWithoutPolicy(t *testing.T) {
+	m, e := retrying(t, cfa635.RetryPolicy{})
+	e.DropResponses(1)
+	if err := m.Put(0, 0, []byte("x")); err != cfa635.ErrTimeout {
+		t.Errorf("Put with a dropped response returned %v, want ErrTimeout", err)
+	}
+}
+
+func TestNoRetryOfNonIdempotentCommand(t *testing.T) {
+	m, e := retrying(t, cfa635.RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+
+	// A retry would get a response, so an ErrTimeout means Reboot sent
+	// only once.
+	e.DropResponses(1)
+	if err := m.Reboot(); err != cfa635.ErrTimeout {
+		t.Errorf("Reboot with a dropped response returned %v, want ErrTimeout", err)
+	}
+	if err := m.Ping([]byte("ok")); err != nil {
+		t.Errorf("Ping after Reboot: %v", err)
+	}
+}
+
+func TestRetryBackoffHonorsContext(t *testing.T) {
+	m, e := retrying(t, cfa635.RetryPolicy{Attempts: 3, Backoff: time.Hour})
+
+	e.DropResponses(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := m.PutContext(ctx, 0, 0, []byte("x")); err != context.DeadlineExceeded {
+		t.Errorf("PutContext canceled during the backoff returned %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("PutContext took %v to notice the canceled context", d)
+	}
+}
@@ -0,0 +1,627 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+// Package cfa635test provides an in-memory CFA635 for testing code that drives
+// the module through package cfa635.
+//
+// An Emulator speaks the CFA635 packet protocol, so it can stand in for a
+// serial port:
+//
+// 	e := cfa635test.NewEmulator()
+// 	m := cfa635.Connect(e)
+// 	defer m.Close()
+// 	if err := m.Put(0, 0, []byte("Hello")); err != nil {
+// 		t.Fatal(err)
+// 	}
+// 	if got := e.LCD(); string(got[0][:5]) != "Hello" {
+// 		t.Errorf("got %q", got[0])
+// 	}
+package cfa635test
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"github.com/sigurn/crc16"
+)
+
+const maxDataLength = 22
+
+var crcTable = crc16.MakeTable(crc16.CRC16_X_25)
+
+// Emulator is an in-memory CFA635. It implements io.ReadWriteCloser: the host
+// writes command packets to it and reads response and report packets from it.
+// An Emulator is safe for concurrent use.
+type Emulator struct {
+	mu     sync.Mutex
+	cond   *sync.Cond // Signaled when out grows or the Emulator closes
+	in     []byte     // Bytes from the host not yet assembled into a packet
+	out    []byte     // Bytes waiting for the host to read them
+	closed bool
+	drop   int // Number of upcoming responses to discard
+
+	dev  device
+	boot device // State restored by a reboot
+
+	flash [16]byte
+
+	// Keypad state for polled reads
+	held, pressedSince, releasedSince byte
+}
+
+// device is the portion of the CFA635's state that can be stored as the boot
+// state.
+type device struct {
+	ddram           cfa635.LCDState
+	cgram           [8][8]byte
+	cursorCol       int
+	cursorRow       int
+	cursorStyle     cfa635.CursorStyle
+	contrast        int
+	lcdBacklight    int
+	keypadBacklight int
+	fanReporting    byte
+	fanPower        [4]int
+	fanFailSafe     byte
+	fanGlitch       [4]int
+	tempReporting   uint32
+	keyPress        byte // Key reporting masks
+	keyRelease      byte
+	atx             cfa635.ATXFunction
+	watchdog        int
+	baud            int
+	gpio            [13]int // Duty cycles; GPIOs 5 through 12 drive the LEDs
+	gpioMode        [13]cfa635.GPIOMode
+}
+
+// Version is the hardware and firmware version string the Emulator reports.
+const Version = "CFA635:h1.5,c1.0"
+
+// NewEmulator returns an Emulator in the CFA635's factory power-on state: a
+// blank screen, CGRAM zeroed, backlights at full brightness, LEDs off, and
+// all key presses and releases reported.
+func NewEmulator() *Emulator {
+	e := &Emulator{
+		boot: device{
+			ddram:           *cfa635.ClearedLCDState(),
+			cursorStyle:     cfa635.BlinkingBlockCursor,
+			contrast:        127,
+			lcdBacklight:    100,
+			keypadBacklight: 100,
+			keyPress:        0b111111,
+			keyRelease:      0b111111,
+			baud:            115200,
+		},
+	}
+	e.dev = e.boot
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// Read blocks until the emulated CFA635 has sent at least one byte and then
+// reads as many bytes as are available into p. After Close, Read returns
+// io.EOF.
+func (e *Emulator) Read(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for len(e.out) == 0 && !e.closed {
+		e.cond.Wait()
+	}
+	if len(e.out) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// Write sends bytes to the emulated CFA635. Complete packets are executed
+// immediately, and their responses become available to Read. Like the real
+// module, the Emulator silently discards bytes that do not form a valid packet.
+func (e *Emulator) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return 0, io.ErrClosedPipe
+	}
+	e.in = append(e.in, p...)
+	for e.execute1() {
+	}
+	return len(p), nil
+}
+
+// Close disconnects the emulated CFA635. Pending and future calls to Read
+// return io.EOF once any buffered bytes have been consumed.
+func (e *Emulator) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed = true
+	e.cond.Broadcast()
+	return nil
+}
+
+// LCD returns the contents of the emulated display data RAM.
+func (e *Emulator) LCD() cfa635.LCDState {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.ddram
+}
+
+// Character returns sprite i (between 0 and 7, inclusive) from the emulated
+// character generator RAM, in the format accepted by Module.SetCharacter.
+func (e *Emulator) Character(i int) [8]byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.cgram[i]
+}
+
+// Cursor returns the position and style of the emulated LCD cursor.
+func (e *Emulator) Cursor() (col, row int, style cfa635.CursorStyle) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.cursorCol, e.dev.cursorRow, e.dev.cursorStyle
+}
+
+// Contrast returns the emulated LCD contrast.
+func (e *Emulator) Contrast() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.contrast
+}
+
+// Backlight returns the brightness of the LCD and keypad backlights, each
+// between 0 and 100, inclusive.
+func (e *Emulator) Backlight() (lcd, keypad int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.lcdBacklight, e.dev.keypadBacklight
+}
+
+// LED returns the green and red duty cycles of one of the four LEDs, numbered
+// as in Module.SetLED.
+func (e *Emulator) LED(led int) (green, red int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.gpio[11-2*led], e.dev.gpio[12-2*led]
+}
+
+// GPIO returns the duty cycle and drive mode of one of the 13 GPIO pins.
+func (e *Emulator) GPIO(pin int) (duty int, mode cfa635.GPIOMode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.gpio[pin], e.dev.gpioMode[pin]
+}
+
+// FanPower returns the power of each of the four fans.
+func (e *Emulator) FanPower() [4]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.fanPower
+}
+
+// Watchdog returns the host watchdog timeout in seconds, or 0 if the watchdog
+// is disabled.
+func (e *Emulator) Watchdog() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.watchdog
+}
+
+// BaudRate returns the speed the emulated serial port is configured for.
+func (e *Emulator) BaudRate() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dev.baud
+}
+
+// PressKey presses k, sending a key activity report if the host has enabled
+// reporting of presses of k.
+func (e *Emulator) PressKey(k cfa635.Key) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	bit := keyBit(k)
+	e.held |= bit
+	e.pressedSince |= bit
+	if e.dev.keyPress&bit != 0 {
+		e.enqueue(0x80, []byte{byte(k)})
+	}
+}
+
+// ReleaseKey releases k, sending a key activity report if the host has enabled
+// reporting of releases of k.
+func (e *Emulator) ReleaseKey(k cfa635.Key) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	bit := keyBit(k)
+	e.held &^= bit
+	e.releasedSince |= bit
+	if e.dev.keyRelease&bit != 0 {
+		e.enqueue(0x80, []byte{byte(k) + 6})
+	}
+}
+
+// keyBit returns the bit that represents k in the CFA635's key masks.
+func keyBit(k cfa635.Key) byte {
+	switch k {
+	case cfa635.UpButton:
+		return 0x01
+	case cfa635.EnterButton:
+		return 0x02
+	case cfa635.ExitButton:
+		return 0x04
+	case cfa635.LeftButton:
+		return 0x08
+	case cfa635.RightButton:
+		return 0x10
+	case cfa635.DownButton:
+		return 0x20
+	default:
+		panic("cfa635test: unknown key")
+	}
+}
+
+// DropResponses makes the Emulator execute the next n commands without
+// responding to them, as if the responses were lost on the serial line.
+func (e *Emulator) DropResponses(n int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.drop = n
+}
+
+// ReportFanSpeed sends a fan speed report, regardless of whether the host has
+// enabled reporting for the fan.
+func (e *Emulator) ReportFanSpeed(fan, tachCycles, timerTicks int) {
+	p := []byte{byte(fan), byte(tachCycles), 0, 0}
+	binary.BigEndian.PutUint16(p[2:], uint16(timerTicks))
+	e.send(0x81, p)
+}
+
+// ReportTemperature sends a temperature report with a valid DOW CRC,
+// regardless of whether the host has enabled reporting for the sensor.
+func (e *Emulator) ReportTemperature(sensor int, celsius float64) {
+	p := []byte{byte(sensor), 0, 0, 1}
+	binary.BigEndian.PutUint16(p[1:3], uint16(math.Round(celsius*16)))
+	e.send(0x82, p)
+}
+
+// Report sends a report packet with any type and data, for testing how the host
+// handles reports it doesn't understand. typ should have its top two bits set.
+func (e *Emulator) Report(typ byte, data []byte) { e.send(typ, data) }
+
+func (e *Emulator) send(typ byte, data []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enqueue(typ, data)
+}
+
+// enqueue frames a packet and makes it available to Read. The caller must hold
+// e.mu.
+func (e *Emulator) enqueue(typ byte, data []byte) {
+	if e.closed {
+		return
+	}
+	end := len(e.out) + 2 + len(data)
+	e.out = append(e.out, typ, byte(len(data)))
+	e.out = append(e.out, data...)
+	e.out = append(e.out, 0, 0)
+	binary.LittleEndian.PutUint16(e.out[end:], crc16.Checksum(e.out[end-2-len(data):end], crcTable))
+	e.cond.Broadcast()
+}
+
+// execute1 executes the first complete packet in e.in, if any, and reports
+// whether it made progress. Bytes that cannot begin a valid packet are dropped
+// one at a time. The caller must hold e.mu.
+func (e *Emulator) execute1() bool {
+	if len(e.in) < 2 {
+		return false
+	}
+	length := int(e.in[1])
+	if e.in[0]&0b1100_0000 != 0 || length > maxDataLength {
+		e.in = e.in[1:]
+		return true
+	}
+	if len(e.in) < 4+length {
+		return false
+	}
+	p := e.in[:2+length]
+	if crc16.Checksum(p, crcTable) != binary.LittleEndian.Uint16(e.in[2+length:]) {
+		e.in = e.in[1:]
+		return true
+	}
+	e.in = e.in[4+length:]
+
+	typ, data := p[0], p[2:]
+	reply, ok := e.execute(typ, data)
+	switch {
+	case e.drop > 0:
+		e.drop--
+	case ok:
+		e.enqueue(0x40|typ, reply)
+	default:
+		e.enqueue(0xc0|typ, nil)
+	}
+	return true
+}
+
+// execute applies a command to the emulated state and returns the payload of
+// the response. It returns false if the command is unsupported or its
+// arguments are invalid. The caller must hold e.mu.
+func (e *Emulator) execute(typ byte, data []byte) ([]byte, bool) {
+	d := &e.dev
+	switch typ {
+	case 0x00: // Ping
+		return data, len(data) <= 16
+
+	case 0x01: // Get hardware and firmware version
+		return []byte(Version), len(data) == 0
+
+	case 0x02: // Write user flash area
+		if len(data) != len(e.flash) {
+			return nil, false
+		}
+		copy(e.flash[:], data)
+		return nil, true
+
+	case 0x03: // Read user flash area
+		return append([]byte(nil), e.flash[:]...), len(data) == 0
+
+	case 0x04: // Store current state as boot state
+		e.boot = *d
+		return nil, len(data) == 0
+
+	case 0x05: // Reboot, reset host, or power off host
+		if len(data) != 3 {
+			return nil, false
+		}
+		switch [3]byte{data[0], data[1], data[2]} {
+		case [3]byte{8, 18, 99}:
+			*d = e.boot
+			e.held, e.pressedSince, e.releasedSince = 0, 0, 0
+			return nil, true
+		case [3]byte{12, 28, 97}, [3]byte{3, 11, 95}:
+			return nil, true
+		}
+		return nil, false
+
+	case 0x06: // Clear LCD screen
+		if len(data) != 0 {
+			return nil, false
+		}
+		d.ddram = *cfa635.ClearedLCDState()
+		d.cursorCol, d.cursorRow = 0, 0
+		return nil, true
+
+	case 0x09: // Set LCD special character data
+		if len(data) != 9 || data[0] > 7 {
+			return nil, false
+		}
+		copy(d.cgram[data[0]][:], data[1:])
+		return nil, true
+
+	case 0x0a: // Read 8 bytes of LCD memory
+		if len(data) != 1 || data[0] < 0x40 || data[0] > 0xe7 {
+			return nil, false
+		}
+		r := []byte{data[0]}
+		for a := int(data[0]); a < int(data[0])+8; a++ {
+			r = append(r, e.readLCDMemory(a))
+		}
+		return r, true
+
+	case 0x0b: // Set LCD cursor position
+		if len(data) != 2 || int(data[0]) >= len(d.ddram[0]) || int(data[1]) >= len(d.ddram) {
+			return nil, false
+		}
+		d.cursorCol, d.cursorRow = int(data[0]), int(data[1])
+		return nil, true
+
+	case 0x0c: // Set LCD cursor style
+		if len(data) != 1 || cfa635.CursorStyle(data[0]) > cfa635.InvertingBlinkingBlockCursor {
+			return nil, false
+		}
+		d.cursorStyle = cfa635.CursorStyle(data[0])
+		return nil, true
+
+	case 0x0d: // Set LCD contrast
+		if len(data) != 1 || data[0] == 255 {
+			return nil, false
+		}
+		d.contrast = int(data[0])
+		return nil, true
+
+	case 0x0e: // Set LCD and keypad backlight
+		if len(data) < 1 || len(data) > 2 {
+			return nil, false
+		}
+		lcd, keypad := int(data[0]), int(data[0])
+		if len(data) == 2 {
+			keypad = int(data[1])
+		}
+		if lcd > 100 || keypad > 100 {
+			return nil, false
+		}
+		d.lcdBacklight, d.keypadBacklight = lcd, keypad
+		return nil, true
+
+	case 0x10: // Set up fan reporting
+		if len(data) != 1 || data[0] > 0b1111 {
+			return nil, false
+		}
+		d.fanReporting = data[0]
+		return nil, true
+
+	case 0x11: // Set fan power
+		if len(data) < 1 || len(data) > len(d.fanPower) {
+			return nil, false
+		}
+		for i, w := range data {
+			if w > 100 {
+				return nil, false
+			}
+			d.fanPower[i] = int(w)
+		}
+		return nil, true
+
+	case 0x12: // Read DOW device information
+		if len(data) != 1 || data[0] > 31 {
+			return nil, false
+		}
+		// No DOW devices are attached.
+		return []byte{data[0], 0, 0, 0, 0, 0, 0, 0, 0}, true
+
+	case 0x13: // Set up temperature reporting
+		if len(data) != 4 {
+			return nil, false
+		}
+		d.tempReporting = binary.LittleEndian.Uint32(data)
+		return nil, true
+
+	case 0x16: // Send command directly to the LCD controller
+		return nil, len(data) == 2 && data[0] <= 1
+
+	case 0x17: // Configure key reporting
+		if len(data) != 2 || data[0] > 0b111111 || data[1] > 0b111111 {
+			return nil, false
+		}
+		d.keyPress, d.keyRelease = data[0], data[1]
+		return nil, true
+
+	case 0x18: // Read keypad, polled mode
+		if len(data) != 0 {
+			return nil, false
+		}
+		r := []byte{e.held, e.pressedSince, e.releasedSince}
+		e.pressedSince, e.releasedSince = 0, 0
+		return r, true
+
+	case 0x19: // Set fan power fail-safe
+		if len(data) != 2 || data[0] > 0b1111 || data[1] == 0 {
+			return nil, false
+		}
+		d.fanFailSafe = data[0]
+		return nil, true
+
+	case 0x1a: // Set fan tachometer glitch filter
+		if len(data) < 1 || len(data) > len(d.fanGlitch) {
+			return nil, false
+		}
+		for i, g := range data {
+			d.fanGlitch[i] = int(g)
+		}
+		return nil, true
+
+	case 0x1b: // Query fan power and fail-safe mask
+		if len(data) != 0 {
+			return nil, false
+		}
+		r := make([]byte, 0, 5)
+		for _, w := range d.fanPower {
+			r = append(r, byte(w))
+		}
+		return append(r, d.fanFailSafe), true
+
+	case 0x1c: // Set ATX power switch functionality
+		if len(data) < 1 || len(data) > 2 || data[0]&0b111 != 0 {
+			return nil, false
+		}
+		d.atx = cfa635.ATXFunction(data[0])
+		return nil, true
+
+	case 0x1d: // Enable, disable, or reset the host watchdog
+		if len(data) != 1 {
+			return nil, false
+		}
+		d.watchdog = int(data[0])
+		return nil, true
+
+	case 0x1f: // Send data to LCD
+		if len(data) < 2 {
+			return nil, false
+		}
+		col, row := int(data[0]), int(data[1])
+		if col >= len(d.ddram[0]) || row >= len(d.ddram) {
+			return nil, false
+		}
+		copy(d.ddram[row][col:], data[2:])
+		return nil, true
+
+	case 0x21: // Set baud rate
+		if len(data) != 1 {
+			return nil, false
+		}
+		switch data[0] {
+		case 0:
+			d.baud = 19200
+		case 1:
+			d.baud = 115200
+		default:
+			return nil, false
+		}
+		return nil, true
+
+	case 0x22: // Set or configure GPIO pin
+		if len(data) < 2 || len(data) > 3 || int(data[0]) >= len(d.gpio) || data[1] > 100 {
+			return nil, false
+		}
+		d.gpio[data[0]] = int(data[1])
+		if len(data) == 3 {
+			if data[2] > 0b1111 {
+				return nil, false
+			}
+			d.gpioMode[data[0]] = cfa635.GPIOMode(data[2])
+		}
+		return nil, true
+
+	case 0x23: // Read GPIO pin levels and configuration state
+		if len(data) != 1 || int(data[0]) >= len(d.gpio) {
+			return nil, false
+		}
+		var level byte
+		if d.gpio[data[0]] > 0 {
+			level = 1
+		}
+		return []byte{data[0], level, byte(d.gpio[data[0]]), byte(d.gpioMode[data[0]])}, true
+
+	default:
+		return nil, false
+	}
+}
+
+// readLCDMemory returns the byte at an LCD controller address. Addresses 0x40
+// through 0x7f are CGRAM; addresses from 0x80 up are DDRAM, with rows 0 and 2
+// and rows 1 and 3 sharing controller lines. The caller must hold e.mu.
+func (e *Emulator) readLCDMemory(a int) byte {
+	d := &e.dev
+	if a < 0x80 {
+		a -= 0x40
+		return d.cgram[a/8][a%8]
+	}
+	a -= 0x80
+	row := 0
+	if a >= 0x40 {
+		row = 1
+		a -= 0x40
+	}
+	if a >= 20 {
+		row += 2
+		a -= 20
+	}
+	if a >= 20 {
+		return 0x20
+	}
+	return d.ddram[row][a]
+}
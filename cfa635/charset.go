@@ -30,18 +30,23 @@ import (
 // GREEK SMALL LETTER BETA (β) are both converted to 0xbe.
 //
 // The returned Transformer will never map anything to bytes in the range 0x00,
-// …, 0x0f.
+// …, 0x0f. It always produces exactly one byte per code point; for an encoder
+// that approximates more text at the cost of that guarantee, see
+// NewTransliterator.
 func NewEncoder() transform.Transformer {
-	identityMapped := unicode.RangeTable{
-		R16: []unicode.Range16{
-			{0x20, 0x23, 1},
-			{0x25, 0x3f, 1},
-			{0x41, 0x5a, 1},
-			{0x61, 0x7a, 1}},
-		R32:         nil,
-		LatinOffset: 83,
-	}
-	return runes.If(runes.In(&identityMapped), nil, encode{})
+	return runes.If(runes.In(identityMapped), nil, encode{})
+}
+
+// identityMapped covers the code points that the CFA635 display character set
+// represents with the same byte that ASCII does.
+var identityMapped = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x20, 0x23, 1},
+		{0x25, 0x3f, 1},
+		{0x41, 0x5a, 1},
+		{0x61, 0x7a, 1}},
+	R32:         nil,
+	LatinOffset: 83,
 }
 
 type encode struct{}
@@ -141,7 +146,7 @@ func encode1(c rune) byte {
 	case 'Ü':
 		return 0x5e
 	case '§':
-		return 0x5d
+		return 0x5f
 	case '¿':
 		return 0x60
 	case 'ä':
@@ -268,7 +273,7 @@ func encode1(c rune) byte {
 		return 0xb9
 	case 'Ξ':
 		return 0xba
-	case '⏺', '⚫', '⬤', '🔴':
+	case '●', '⏺', '⚫', '⬤', '🔴':
 		return 0xbb
 	case 'Æ':
 		return 0xbc
@@ -310,6 +315,16 @@ func encode1(c rune) byte {
 		return 0xce
 	case '◇', '◊', '♢':
 		return 0xcf
+	case '■', '⏹', '⬛':
+		return 0xd0
+	case '▪':
+		return 0xd1
+	case '▫':
+		return 0xd2
+	case '▯':
+		return 0xd3
+	case '▮':
+		return 0xd4
 	case 'ƒ':
 		return 0xd5
 	case 0x2588:
@@ -360,6 +375,10 @@ func encode1(c rune) byte {
 		return 0xec
 	case 'ô':
 		return 0xed
+	case 'Ů':
+		return 0xee
+	case 'ů':
+		return 0xef
 	case 'Č':
 		return 0xf0
 	case 'Ě':
@@ -395,3 +414,79 @@ func encode1(c rune) byte {
 	}
 	return 0x60 // ¿
 }
+
+// lookup returns the byte in the CFA635 display character set that represents
+// a code point, if there is one. It does not handle code points that
+// identityMapped covers.
+func lookup(c rune) (byte, bool) {
+	b := encode1(c)
+	return b, b != 0x60 || c == '¿'
+}
+
+// NewDecoder returns a Transformer that converts the CFA635 display character
+// set to UTF-8, mapping each byte to the Unicode code point that most resembles
+// it.
+//
+// Bytes 0x00, …, 0x07 display sprites from character generator RAM, which have
+// no fixed appearance; the returned Transformer converts them to the
+// placeholders ⓪, …, ⑦. Bytes 0x08, …, 0x0f repeat 0x00, …, 0x07.
+//
+// Decoding and then encoding text returns the original bytes, except for CGRAM
+// placeholders and the few characters that NewEncoder never produces.
+func NewDecoder() transform.Transformer { return decodeCharset{} }
+
+// DecodeCharacter converts a single byte from the CFA635 display character set
+// the way NewDecoder does.
+func DecodeCharacter(c byte) rune { return decodeTable[c] }
+
+type decodeCharset struct{}
+
+func (_ decodeCharset) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		r := decodeTable[src[nSrc]]
+		if nDst+utf8.RuneLen(r) > len(dst) {
+			err = transform.ErrShortDst
+			break
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		nSrc++
+	}
+	return
+}
+
+func (_ decodeCharset) Reset() {}
+
+var decodeTable = [256]rune{
+	'⓪', '①', '②', '③', '④', '⑤', '⑥', '⑦', // 0x00
+	'⓪', '①', '②', '③', '④', '⑤', '⑥', '⑦', // 0x08
+	'▶', '◀', '⏫', '⏬', '«', '»', '↖', '↗', // 0x10
+	'↙', '↘', '▲', '▼', '↲', '^', 'ᵛ', '█', // 0x18
+	' ', '!', '"', '#', '¤', '%', '&', '\'', // 0x20
+	'(', ')', '*', '+', ',', '-', '.', '/', // 0x28
+	'0', '1', '2', '3', '4', '5', '6', '7', // 0x30
+	'8', '9', ':', ';', '<', '=', '>', '?', // 0x38
+	'¡', 'A', 'B', 'C', 'D', 'E', 'F', 'G', // 0x40
+	'H', 'I', 'J', 'K', 'L', 'M', 'N', 'O', // 0x48
+	'P', 'Q', 'R', 'S', 'T', 'U', 'V', 'W', // 0x50
+	'X', 'Y', 'Z', 'Ä', 'Ö', 'Ñ', 'Ü', '§', // 0x58
+	'¿', 'a', 'b', 'c', 'd', 'e', 'f', 'g', // 0x60
+	'h', 'i', 'j', 'k', 'l', 'm', 'n', 'o', // 0x68
+	'p', 'q', 'r', 's', 't', 'u', 'v', 'w', // 0x70
+	'x', 'y', 'z', 'ä', 'ö', 'ñ', 'ü', 'à', // 0x78
+	'°', '¹', '²', '³', '⁴', '⁵', '⁶', '⁷', // 0x80
+	'⁸', '⁹', '½', '¼', '±', '≥', '≤', 'µ', // 0x88
+	'♪', '♬', '🔔', '♥', '◆', '𐎂', '「', '」', // 0x90
+	'“', '”', '(', ')', 'α', 'ε', 'δ', '∞', // 0x98
+	'@', '£', '$', '¥', 'è', 'é', 'ù', 'ì', // 0xa0
+	'ò', 'Ç', 'ᵖ', 'Ø', 'ø', 'ʳ', 'Å', 'å', // 0xa8
+	'Δ', '¢', 'Φ', 'τ', 'λ', 'Ω', 'π', 'Ψ', // 0xb0
+	'Σ', 'Θ', 'Ξ', '●', 'Æ', 'æ', 'β', 'É', // 0xb8
+	'Γ', 'Λ', 'Π', 'Υ', '_', 'È', 'Ê', 'ê', // 0xc0
+	'ç', 'ğ', 'Ş', 'ş', 'İ', 'ı', '~', '◇', // 0xc8
+	'■', '▪', '▫', '▯', '▮', 'ƒ', '█', '▊', // 0xd0
+	'▋', '▍', '▏', '₧', '◦', '•', '↑', '→', // 0xd8
+	'↓', '←', 'Á', 'Í', 'Ó', 'Ú', 'Ý', 'á', // 0xe0
+	'í', 'ó', 'ú', 'ý', 'Ô', 'ô', 'Ů', 'ů', // 0xe8
+	'Č', 'Ě', 'Ř', 'Š', 'Ž', 'č', 'ě', 'ř', // 0xf0
+	'š', 'ž', '[', '\\', ']', '{', '|', '}', // 0xf8
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"golang.org/x/text/transform"
+)
+
+func TestDecodeEncodeRoundTrip(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	decoded, _, err := transform.Bytes(cfa635.NewDecoder(), all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := utf8.RuneCount(decoded); n != 256 {
+		t.Fatalf("decoded 256 bytes to %d code points", n)
+	}
+
+	// A few bytes share a representative with another byte, so they can't
+	// round-trip. Decoding what the encoder chose must give the same text.
+	users := make(map[rune]int)
+	for _, r := range string(decoded) {
+		users[r]++
+	}
+
+	encoded, _, err := transform.Bytes(cfa635.NewEncoder(), decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded) != 256 {
+		t.Fatalf("encoded 256 code points to %d bytes", len(encoded))
+	}
+	for i, b := range encoded {
+		r := cfa635.DecodeCharacter(byte(i))
+		switch {
+		case i < 0x10:
+			// CGRAM placeholders don't round-trip by design.
+		case users[r] == 1 && b != byte(i):
+			t.Errorf("%#02x decoded to %q, which encoded to %#02x", i, r, b)
+		case cfa635.DecodeCharacter(b) != r:
+			t.Errorf("%#02x decoded to %q, which encoded to %#02x (%q)", i, r, b, cfa635.DecodeCharacter(b))
+		}
+	}
+}
+
+func TestDecodeCGRAM(t *testing.T) {
+	in := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	const want = "⓪①②③④⑤⑥⑦⓪①②③④⑤⑥⑦"
+	if got, _, _ := transform.Bytes(cfa635.NewDecoder(), in); string(got) != want {
+		t.Errorf("decoded CGRAM characters to %q, want %q", got, want)
+	}
+}
@@ -17,6 +17,7 @@ package cfa635
 import (
 	"io"
 	"log"
+	"sync/atomic"
 	"time"
 )
 
@@ -31,9 +32,9 @@ var (
 	timeout = 250 * time.Millisecond // maximum response latency
 )
 
-// buffer copies bytes from an io.Reader into a channel, logging any errors as
-// it goes. It closes the channel when no more bytes are left or when it
-// receives on the done channel.
+// buffer copies bytes from an io.Reader into a channel. It closes the channel
+// when no more bytes are left or when reading fails, which usually means the
+// CFA635 has been disconnected.
 func buffer(r io.ByteReader, w chan<- byte) {
 	defer close(w)
 	for {
@@ -43,75 +44,116 @@ func buffer(r io.ByteReader, w chan<- byte) {
 		}
 		if err != nil {
 			log.Print("failed to read byte from CFA635: ", err)
-			continue
+			break
 		}
 		w <- b
 	}
 }
 
-// decode reassembles bytes into packets, logging any errors as it goes.
-func decode(bytes <-chan byte, packets chan<- []byte) {
-	defer close(packets)
-Outer:
-	for {
-		p := make([]byte, 0, maxPacketBytes)
+// DecoderStats counts the problems the packet decoder has recovered from.
+type DecoderStats struct {
+	DroppedBytes uint64 // Bytes discarded while searching for a packet
+	BadFrames    uint64 // Would-be packets with a bad CRC or that never finished
+}
 
-		// Read packet type.
-		typ, ok := <-bytes
-		if !ok {
-			break
-		}
-		p = append(p, typ)
+// frameStatus classifies the bytes at the start of a buffer.
+type frameStatus int
 
-		// The rest of the packet should come in fairly quickly.
-		timedout := time.After(timeout)
+const (
+	frameIncomplete frameStatus = iota // A prefix of what might be a packet
+	frameGarbage                       // Not the start of any packet
+	frameBadCRC                        // A complete frame with a bad CRC
+	frameOK                            // A complete packet
+)
 
-		// Read packet length.
-		var length byte
-		select {
-		case <-timedout:
-			log.Print(msgPacketFailed, ' ', msgTimedOut)
-			continue
+// frame looks for a packet at the start of b. If it finds one, it returns the
+// packet (without its CRC) and the number of bytes the packet occupies in b.
+func frame(b []byte) (p []byte, n int, status frameStatus) {
+	if len(b) < 1 {
+		return nil, 0, frameIncomplete
+	}
+	// The top two bits of the type are 01 for responses, 10 for reports,
+	// and 11 for errors. The CFA635 never sends commands (00).
+	if b[0]&0b1100_0000 == 0 {
+		return nil, 0, frameGarbage
+	}
+	if len(b) < 2 {
+		return nil, 0, frameIncomplete
+	}
+	if b[1] > maxPacketBytes-4 {
+		return nil, 0, frameGarbage
+	}
+	n = 4 + int(b[1])
+	if len(b) < n {
+		return nil, 0, frameIncomplete
+	}
+	p, ok := popCRC(b[:n])
+	if !ok {
+		return nil, 0, frameBadCRC
+	}
+	return p, n, frameOK
+}
 
-		case length, ok = <-bytes:
-			if !ok {
-				break Outer
-			}
-			if length > 22 {
-				log.Print(msgPacketFailed, " got too-long data_length ", length)
-				continue
-			}
-			p = append(p, length)
-		}
+// decode reassembles bytes into packets. It scans the byte stream for a
+// well-formed type, length, and CRC, skipping a byte at a time past anything
+// that is not a packet, so it realigns with the stream after line noise or a
+// truncated packet. It logs bad frames and tallies problems in stats.
+func decode(bytes <-chan byte, packets chan<- []byte, stats *DecoderStats) {
+	defer close(packets)
 
-		// Read the data and CRC.
-		for i := 0; i < int(length)+2; i++ {
-			select {
-			case <-timedout:
-				log.Print(msgPacketFailed, ' ', msgTimedOut)
-				continue
-			case b, ok := <-bytes:
-				if !ok {
-					break Outer
-				}
-				p = append(p, b)
+	buf := make([]byte, 0, 2*maxPacketBytes)
+	var timedout <-chan time.Time // Fires if the packet at the head of buf stalls
+	drop := func() {
+		buf = append(buf[:0], buf[1:]...)
+		atomic.AddUint64(&stats.DroppedBytes, 1)
+		timedout = nil
+	}
+
+	for {
+	Scan:
+		for len(buf) > 0 {
+			p, n, status := frame(buf)
+			switch status {
+			case frameIncomplete:
+				break Scan
+			case frameGarbage:
+				drop()
+			case frameBadCRC:
+				log.Print(msgPacketFailed, " CRC failure")
+				atomic.AddUint64(&stats.BadFrames, 1)
+				drop()
+			case frameOK:
+				packets <- append([]byte(nil), p...)
+				buf = append(buf[:0], buf[n:]...)
+				timedout = nil
 			}
 		}
 
-		if p, ok = popCRC(p); !ok {
-			log.Printf("%s CRC failure\n", msgPacketFailed)
-			continue
+		// The rest of a packet should come in fairly quickly.
+		if len(buf) > 0 && timedout == nil {
+			timedout = time.After(timeout)
 		}
 
-		// Save the packet.
-		packets <- p
+		select {
+		case b, ok := <-bytes:
+			if !ok {
+				return
+			}
+			buf = append(buf, b)
+
+		case <-timedout:
+			log.Print(msgPacketFailed, " ", msgTimedOut)
+			atomic.AddUint64(&stats.BadFrames, 1)
+			drop()
+		}
 	}
 }
 
-// route splits a channel of packets into channels of reports and responses.
-func route(packets <-chan []byte, reports chan<- any, responses chan<- []byte) {
-	defer close(reports)
-	defer close(responses)
+// route splits a channel of packets into reports, which it publishes, and
+// responses, which it sends on a channel. The responses channel must have a
+// buffer of size 1; if the host has not collected the previous response by the
+// time the next one arrives, the previous one is stale, and route discards it.
+func route(packets <-chan []byte, publish func(Report), responses chan []byte) {
 	for p := range packets {
 		switch p[0] & 0b1100_0000 >> 6 {
 		case 0b10:
@@ -120,9 +162,17 @@ func route(packets <-chan []byte, reports chan<- any, responses chan<- []byte) {
 				log.Print(err.Error())
 				continue
 			}
-			reports <- r
+			publish(r)
 		default:
-			responses <- p
+			select {
+			case responses <- p:
+			default:
+				select {
+				case <-responses:
+				default:
+				}
+				responses <- p
+			}
 		}
 	}
 }
@@ -0,0 +1,134 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+// stream builds a byte stream from a fuzzer's input. Each chunk of the input
+// is either a packet, framed with pushCRC, or garbage copied verbatim:
+//
+//   - an even byte, then a type (whose top two bits are forced nonzero), a
+//     length (reduced mod 23), and that many payload bytes, for a packet;
+//   - an odd byte b, then b>>1%16 bytes of garbage.
+//
+// It returns the stream, the packets it contains without their CRCs, and
+// whether each byte of the stream is part of a packet.
+func stream(prog []byte) (in []byte, packets [][]byte, framed []bool) {
+	next := func() byte {
+		if len(prog) == 0 {
+			return 0
+		}
+		b := prog[0]
+		prog = prog[1:]
+		return b
+	}
+	for len(prog) > 0 {
+		op := next()
+		if op&1 == 0 {
+			p := []byte{next() | 0b0100_0000, next() % (maxPacketBytes - 3)}
+			for i := 0; i < int(p[1]); i++ {
+				p = append(p, next())
+			}
+			packets = append(packets, p)
+			for _, b := range pushCRC(append([]byte(nil), p...)) {
+				in = append(in, b)
+				framed = append(framed, true)
+			}
+		} else {
+			for i := 0; i < int(op>>1%16); i++ {
+				in = append(in, next())
+				framed = append(framed, false)
+			}
+		}
+	}
+
+	// Zeros can't start a packet, so a packet's worth of them resolves any
+	// frame still pending at the end of the stream.
+	for i := 0; i < maxPacketBytes; i++ {
+		in = append(in, 0)
+		framed = append(framed, false)
+	}
+	return in, packets, framed
+}
+
+func decodeAll(in []byte) ([][]byte, DecoderStats) {
+	ch := make(chan byte, len(in))
+	for _, b := range in {
+		ch <- b
+	}
+	close(ch)
+
+	var stats DecoderStats
+	packets := make(chan []byte)
+	go decode(ch, packets, &stats)
+	var out [][]byte
+	for p := range packets {
+		out = append(out, p)
+	}
+	return out, stats
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 0x40, 3, 'a', 'b', 'c'})
+	f.Add([]byte{7, 0x80, 0x05, 1, 2, 0, 0x80, 2, 9, 9})  // Truncated report
+	f.Add([]byte{5, 0x3f, 0xff, 0, 0xc0, 22, 1, 2, 3, 4}) // Bad length
+	f.Add([]byte{0, 0x40, 0, 0, 0x80, 0, 1, 0x41, 0, 0})
+
+	// The decoder logs every bad frame.
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	f.Fuzz(func(t *testing.T, prog []byte) {
+		in, want, framed := stream(prog)
+
+		// Garbage that happens to contain a well-formed packet is
+		// indistinguishable from one. Otherwise, the decoder should
+		// drop every byte of garbage, and it should find a bad frame
+		// wherever the garbage has a plausible type and length.
+		var wantDropped, wantBad uint64
+		for i := range in {
+			if framed[i] {
+				continue
+			}
+			switch _, _, status := frame(in[i:]); status {
+			case frameOK:
+				t.Skip("garbage contains a packet")
+			case frameBadCRC:
+				wantBad++
+			}
+			wantDropped++
+		}
+
+		got, stats := decodeAll(in)
+		if len(got) != len(want) {
+			t.Fatalf("decoded %d packets, want %d\ngot  %x\nwant %x", len(got), len(want), got, want)
+		}
+		for i := range want {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Errorf("packet %d = %x, want %x", i, got[i], want[i])
+			}
+		}
+		if stats.DroppedBytes != wantDropped || stats.BadFrames != wantBad {
+			t.Errorf("stats = %+v, want DroppedBytes %d and BadFrames %d", stats, wantDropped, wantBad)
+		}
+	})
+}
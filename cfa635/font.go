@@ -0,0 +1,375 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635
+
+// ROMCharacter returns the bitmap of a character in the CFA635's character
+// generator ROM. ROM characters are five pixels wide and leave the leftmost
+// column of the cell blank.
+//
+// Characters 0x00, …, 0x0f come from CGRAM rather than ROM, so ROMCharacter
+// returns a blank Sprite for them.
+func ROMCharacter(c byte) Sprite { return rom[c] }
+
+// rom is the CFA635 character generator ROM, transcribed from the data sheet.
+// NewEncoder never produces 0x1f, 0x9a, 0x9b, 0xd1, …, 0xd4, 0xee, or 0xef;
+// the glyphs at those positions are approximate.
+var rom = [256]Sprite{
+	0x10: {0x08, 0x0c, 0x0e, 0x0f, 0x0e, 0x0c, 0x08, 0x00}, // ▶
+	0x11: {0x02, 0x06, 0x0e, 0x1e, 0x0e, 0x06, 0x02, 0x00}, // ◀
+	0x12: {0x04, 0x0e, 0x1f, 0x00, 0x04, 0x0e, 0x1f, 0x00}, // ⏫
+	0x13: {0x1f, 0x0e, 0x04, 0x00, 0x1f, 0x0e, 0x04, 0x00}, // ⏬
+	0x14: {0x00, 0x05, 0x0a, 0x14, 0x0a, 0x05, 0x00, 0x00}, // «
+	0x15: {0x00, 0x14, 0x0a, 0x05, 0x0a, 0x14, 0x00, 0x00}, // »
+	0x16: {0x00, 0x1c, 0x18, 0x14, 0x02, 0x01, 0x00, 0x00}, // ↖
+	0x17: {0x00, 0x07, 0x03, 0x05, 0x08, 0x10, 0x00, 0x00}, // ↗
+	0x18: {0x00, 0x01, 0x02, 0x14, 0x18, 0x1c, 0x00, 0x00}, // ↙
+	0x19: {0x00, 0x10, 0x08, 0x05, 0x03, 0x07, 0x00, 0x00}, // ↘
+	0x1a: {0x00, 0x04, 0x04, 0x0e, 0x0e, 0x1f, 0x00, 0x00}, // ▲
+	0x1b: {0x00, 0x1f, 0x0e, 0x0e, 0x04, 0x04, 0x00, 0x00}, // ▼
+	0x1c: {0x01, 0x01, 0x05, 0x09, 0x1f, 0x08, 0x04, 0x00}, // ↲
+	0x1d: {0x04, 0x0a, 0x11, 0x00, 0x00, 0x00, 0x00, 0x00}, // ^
+	0x1e: {0x11, 0x0a, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00}, // ᵛ
+	0x1f: {0x1f, 0x1f, 0x1f, 0x1f, 0x1f, 0x1f, 0x1f, 0x1f}, // █
+	0x20: {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // space
+	0x21: {0x04, 0x04, 0x04, 0x04, 0x00, 0x00, 0x04, 0x00}, // !
+	0x22: {0x0a, 0x0a, 0x0a, 0x00, 0x00, 0x00, 0x00, 0x00}, // "
+	0x23: {0x0a, 0x0a, 0x1f, 0x0a, 0x1f, 0x0a, 0x0a, 0x00}, // #
+	0x24: {0x00, 0x11, 0x0e, 0x0a, 0x0e, 0x11, 0x00, 0x00}, // ¤
+	0x25: {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03, 0x00}, // %
+	0x26: {0x0c, 0x12, 0x14, 0x08, 0x15, 0x12, 0x0d, 0x00}, // &
+	0x27: {0x0c, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00}, // '
+	0x28: {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02, 0x00}, // (
+	0x29: {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08, 0x00}, // )
+	0x2a: {0x00, 0x04, 0x15, 0x0e, 0x15, 0x04, 0x00, 0x00}, // *
+	0x2b: {0x00, 0x04, 0x04, 0x1f, 0x04, 0x04, 0x00, 0x00}, // +
+	0x2c: {0x00, 0x00, 0x00, 0x00, 0x0c, 0x04, 0x08, 0x00}, // ,
+	0x2d: {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00, 0x00}, // -
+	0x2e: {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c, 0x00}, // .
+	0x2f: {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00, 0x00}, // /
+	0x30: {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e, 0x00}, // 0
+	0x31: {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e, 0x00}, // 1
+	0x32: {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f, 0x00}, // 2
+	0x33: {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e, 0x00}, // 3
+	0x34: {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02, 0x00}, // 4
+	0x35: {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e, 0x00}, // 5
+	0x36: {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e, 0x00}, // 6
+	0x37: {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08, 0x00}, // 7
+	0x38: {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e, 0x00}, // 8
+	0x39: {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c, 0x00}, // 9
+	0x3a: {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00, 0x00}, // :
+	0x3b: {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x04, 0x08, 0x00}, // ;
+	0x3c: {0x02, 0x04, 0x08, 0x10, 0x08, 0x04, 0x02, 0x00}, // <
+	0x3d: {0x00, 0x00, 0x1f, 0x00, 0x1f, 0x00, 0x00, 0x00}, // =
+	0x3e: {0x08, 0x04, 0x02, 0x01, 0x02, 0x04, 0x08, 0x00}, // >
+	0x3f: {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04, 0x00}, // ?
+	0x40: {0x04, 0x00, 0x04, 0x04, 0x04, 0x04, 0x04, 0x00}, // ¡
+	0x41: {0x0e, 0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x00}, // A
+	0x42: {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e, 0x00}, // B
+	0x43: {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e, 0x00}, // C
+	0x44: {0x1c, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1c, 0x00}, // D
+	0x45: {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f, 0x00}, // E
+	0x46: {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10, 0x00}, // F
+	0x47: {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f, 0x00}, // G
+	0x48: {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11, 0x00}, // H
+	0x49: {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e, 0x00}, // I
+	0x4a: {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c, 0x00}, // J
+	0x4b: {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11, 0x00}, // K
+	0x4c: {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f, 0x00}, // L
+	0x4d: {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11, 0x00}, // M
+	0x4e: {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11, 0x00}, // N
+	0x4f: {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e, 0x00}, // O
+	0x50: {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10, 0x00}, // P
+	0x51: {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d, 0x00}, // Q
+	0x52: {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11, 0x00}, // R
+	0x53: {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e, 0x00}, // S
+	0x54: {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x00}, // T
+	0x55: {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e, 0x00}, // U
+	0x56: {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04, 0x00}, // V
+	0x57: {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a, 0x00}, // W
+	0x58: {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11, 0x00}, // X
+	0x59: {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04, 0x00}, // Y
+	0x5a: {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f, 0x00}, // Z
+	0x5b: {0x0a, 0x00, 0x0e, 0x11, 0x1f, 0x11, 0x11, 0x00}, // Ä
+	0x5c: {0x0a, 0x00, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00}, // Ö
+	0x5d: {0x0d, 0x12, 0x11, 0x19, 0x15, 0x13, 0x11, 0x00}, // Ñ
+	0x5e: {0x0a, 0x00, 0x11, 0x11, 0x11, 0x11, 0x0e, 0x00}, // Ü
+	0x5f: {0x0e, 0x10, 0x0e, 0x11, 0x0e, 0x01, 0x0e, 0x00}, // §
+	0x60: {0x04, 0x00, 0x04, 0x08, 0x10, 0x11, 0x0e, 0x00}, // ¿
+	0x61: {0x00, 0x00, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x00}, // a
+	0x62: {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x1e, 0x00}, // b
+	0x63: {0x00, 0x00, 0x0e, 0x10, 0x10, 0x11, 0x0e, 0x00}, // c
+	0x64: {0x01, 0x01, 0x0d, 0x13, 0x11, 0x11, 0x0f, 0x00}, // d
+	0x65: {0x00, 0x00, 0x0e, 0x11, 0x1f, 0x10, 0x0e, 0x00}, // e
+	0x66: {0x06, 0x09, 0x08, 0x1c, 0x08, 0x08, 0x08, 0x00}, // f
+	0x67: {0x00, 0x0f, 0x11, 0x11, 0x0f, 0x01, 0x0e, 0x00}, // g
+	0x68: {0x10, 0x10, 0x16, 0x19, 0x11, 0x11, 0x11, 0x00}, // h
+	0x69: {0x04, 0x00, 0x0c, 0x04, 0x04, 0x04, 0x0e, 0x00}, // i
+	0x6a: {0x02, 0x00, 0x06, 0x02, 0x02, 0x12, 0x0c, 0x00}, // j
+	0x6b: {0x10, 0x10, 0x12, 0x14, 0x18, 0x14, 0x12, 0x00}, // k
+	0x6c: {0x0c, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e, 0x00}, // l
+	0x6d: {0x00, 0x00, 0x1a, 0x15, 0x15, 0x11, 0x11, 0x00}, // m
+	0x6e: {0x00, 0x00, 0x16, 0x19, 0x11, 0x11, 0x11, 0x00}, // n
+	0x6f: {0x00, 0x00, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00}, // o
+	0x70: {0x00, 0x00, 0x1e, 0x11, 0x1e, 0x10, 0x10, 0x00}, // p
+	0x71: {0x00, 0x00, 0x0d, 0x13, 0x0f, 0x01, 0x01, 0x00}, // q
+	0x72: {0x00, 0x00, 0x16, 0x19, 0x10, 0x10, 0x10, 0x00}, // r
+	0x73: {0x00, 0x00, 0x0e, 0x10, 0x0e, 0x01, 0x1e, 0x00}, // s
+	0x74: {0x08, 0x08, 0x1c, 0x08, 0x08, 0x09, 0x06, 0x00}, // t
+	0x75: {0x00, 0x00, 0x11, 0x11, 0x11, 0x13, 0x0d, 0x00}, // u
+	0x76: {0x00, 0x00, 0x11, 0x11, 0x11, 0x0a, 0x04, 0x00}, // v
+	0x77: {0x00, 0x00, 0x11, 0x11, 0x15, 0x15, 0x0a, 0x00}, // w
+	0x78: {0x00, 0x00, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x00}, // x
+	0x79: {0x00, 0x00, 0x11, 0x11, 0x0f, 0x01, 0x0e, 0x00}, // y
+	0x7a: {0x00, 0x00, 0x1f, 0x02, 0x04, 0x08, 0x1f, 0x00}, // z
+	0x7b: {0x0a, 0x00, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x00}, // ä
+	0x7c: {0x0a, 0x00, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00}, // ö
+	0x7d: {0x0d, 0x12, 0x00, 0x16, 0x19, 0x11, 0x11, 0x00}, // ñ
+	0x7e: {0x0a, 0x00, 0x11, 0x11, 0x11, 0x13, 0x0d, 0x00}, // ü
+	0x7f: {0x08, 0x04, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x00}, // à
+	0x80: {0x0c, 0x12, 0x12, 0x0c, 0x00, 0x00, 0x00, 0x00}, // °
+	0x81: {0x04, 0x0c, 0x04, 0x04, 0x0e, 0x00, 0x00, 0x00}, // ¹
+	0x82: {0x0c, 0x02, 0x04, 0x08, 0x0e, 0x00, 0x00, 0x00}, // ²
+	0x83: {0x0c, 0x02, 0x04, 0x02, 0x0c, 0x00, 0x00, 0x00}, // ³
+	0x84: {0x02, 0x06, 0x0a, 0x0e, 0x02, 0x00, 0x00, 0x00}, // ⁴
+	0x85: {0x0e, 0x08, 0x0c, 0x02, 0x0c, 0x00, 0x00, 0x00}, // ⁵
+	0x86: {0x06, 0x08, 0x0c, 0x0a, 0x04, 0x00, 0x00, 0x00}, // ⁶
+	0x87: {0x0e, 0x02, 0x04, 0x04, 0x04, 0x00, 0x00, 0x00}, // ⁷
+	0x88: {0x04, 0x0a, 0x04, 0x0a, 0x04, 0x00, 0x00, 0x00}, // ⁸
+	0x89: {0x04, 0x0a, 0x06, 0x02, 0x0c, 0x00, 0x00, 0x00}, // ⁹
+	0x8a: {0x10, 0x10, 0x10, 0x06, 0x01, 0x02, 0x07, 0x00}, // ½
+	0x8b: {0x10, 0x10, 0x10, 0x02, 0x06, 0x07, 0x02, 0x00}, // ¼
+	0x8c: {0x04, 0x04, 0x1f, 0x04, 0x04, 0x00, 0x1f, 0x00}, // ±
+	0x8d: {0x08, 0x04, 0x02, 0x04, 0x08, 0x00, 0x1f, 0x00}, // ≥
+	0x8e: {0x02, 0x04, 0x08, 0x04, 0x02, 0x00, 0x1f, 0x00}, // ≤
+	0x8f: {0x00, 0x00, 0x11, 0x11, 0x13, 0x1d, 0x10, 0x00}, // µ
+	0x90: {0x04, 0x06, 0x05, 0x04, 0x04, 0x1c, 0x1c, 0x00}, // ♪
+	0x91: {0x0f, 0x09, 0x09, 0x09, 0x1b, 0x1b, 0x00, 0x00}, // ♬
+	0x92: {0x04, 0x0e, 0x0e, 0x0e, 0x1f, 0x00, 0x04, 0x00}, // bell
+	0x93: {0x00, 0x0a, 0x1f, 0x1f, 0x0e, 0x04, 0x00, 0x00}, // ♥
+	0x94: {0x00, 0x04, 0x0e, 0x1f, 0x0e, 0x04, 0x00, 0x00}, // ◆
+	0x95: {0x00, 0x1f, 0x15, 0x1f, 0x00, 0x00, 0x00, 0x00}, // 𐎂
+	0x96: {0x0e, 0x08, 0x08, 0x08, 0x00, 0x00, 0x00, 0x00}, // 「
+	0x97: {0x00, 0x00, 0x00, 0x02, 0x02, 0x02, 0x0e, 0x00}, // 」
+	0x98: {0x09, 0x12, 0x1b, 0x00, 0x00, 0x00, 0x00, 0x00}, // “
+	0x99: {0x1b, 0x09, 0x12, 0x00, 0x00, 0x00, 0x00, 0x00}, // ”
+	0x9a: {0x02, 0x04, 0x04, 0x04, 0x04, 0x04, 0x02, 0x00}, // (
+	0x9b: {0x08, 0x04, 0x04, 0x04, 0x04, 0x04, 0x08, 0x00}, // )
+	0x9c: {0x00, 0x00, 0x09, 0x15, 0x12, 0x12, 0x0d, 0x00}, // α
+	0x9d: {0x00, 0x00, 0x0e, 0x10, 0x0c, 0x10, 0x0e, 0x00}, // ε
+	0x9e: {0x0e, 0x08, 0x04, 0x0e, 0x11, 0x11, 0x0e, 0x00}, // δ
+	0x9f: {0x00, 0x00, 0x0a, 0x15, 0x15, 0x0a, 0x00, 0x00}, // ∞
+	0xa0: {0x0e, 0x11, 0x01, 0x0d, 0x15, 0x15, 0x0e, 0x00}, // @
+	0xa1: {0x06, 0x09, 0x08, 0x1c, 0x08, 0x09, 0x16, 0x00}, // £
+	0xa2: {0x04, 0x0f, 0x14, 0x0e, 0x05, 0x1e, 0x04, 0x00}, // $
+	0xa3: {0x11, 0x0a, 0x1f, 0x04, 0x1f, 0x04, 0x04, 0x00}, // ¥
+	0xa4: {0x08, 0x04, 0x0e, 0x11, 0x1f, 0x10, 0x0e, 0x00}, // è
+	0xa5: {0x02, 0x04, 0x0e, 0x11, 0x1f, 0x10, 0x0e, 0x00}, // é
+	0xa6: {0x08, 0x04, 0x11, 0x11, 0x11, 0x13, 0x0d, 0x00}, // ù
+	0xa7: {0x08, 0x04, 0x00, 0x0c, 0x04, 0x04, 0x0e, 0x00}, // ì
+	0xa8: {0x08, 0x04, 0x00, 0x0e, 0x11, 0x11, 0x0e, 0x00}, // ò
+	0xa9: {0x0e, 0x11, 0x10, 0x10, 0x11, 0x0e, 0x04, 0x0c}, // Ç
+	0xaa: {0x1c, 0x12, 0x1c, 0x10, 0x10, 0x00, 0x00, 0x00}, // ᵖ
+	0xab: {0x0e, 0x13, 0x15, 0x15, 0x15, 0x19, 0x0e, 0x00}, // Ø
+	0xac: {0x00, 0x01, 0x0e, 0x13, 0x15, 0x19, 0x0e, 0x00}, // ø
+	0xad: {0x16, 0x18, 0x10, 0x10, 0x00, 0x00, 0x00, 0x00}, // ʳ
+	0xae: {0x04, 0x0a, 0x04, 0x0e, 0x11, 0x1f, 0x11, 0x00}, // Å
+	0xaf: {0x06, 0x06, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x00}, // å
+	0xb0: {0x04, 0x04, 0x0a, 0x0a, 0x11, 0x11, 0x1f, 0x00}, // Δ
+	0xb1: {0x04, 0x0e, 0x15, 0x14, 0x15, 0x0e, 0x04, 0x00}, // ¢
+	0xb2: {0x04, 0x0e, 0x15, 0x15, 0x15, 0x0e, 0x04, 0x00}, // Φ
+	0xb3: {0x00, 0x00, 0x1f, 0x04, 0x04, 0x04, 0x02, 0x00}, // τ
+	0xb4: {0x08, 0x04, 0x04, 0x0a, 0x0a, 0x11, 0x11, 0x00}, // λ
+	0xb5: {0x00, 0x0e, 0x11, 0x11, 0x11, 0x0a, 0x1b, 0x00}, // Ω
+	0xb6: {0x00, 0x00, 0x1f, 0x0a, 0x0a, 0x0a, 0x13, 0x00}, // π
+	0xb7: {0x15, 0x15, 0x15, 0x0e, 0x04, 0x04, 0x04, 0x00}, // Ψ
+	0xb8: {0x1f, 0x10, 0x08, 0x04, 0x08, 0x10, 0x1f, 0x00}, // Σ
+	0xb9: {0x0e, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x0e, 0x00}, // Θ
+	0xba: {0x1f, 0x00, 0x00, 0x0e, 0x00, 0x00, 0x1f, 0x00}, // Ξ
+	0xbb: {0x00, 0x0e, 0x1f, 0x1f, 0x1f, 0x0e, 0x00, 0x00}, // ●
+	0xbc: {0x0f, 0x14, 0x14, 0x1f, 0x14, 0x14, 0x17, 0x00}, // Æ
+	0xbd: {0x00, 0x00, 0x1a, 0x05, 0x0f, 0x14, 0x1b, 0x00}, // æ
+	0xbe: {0x0c, 0x12, 0x12, 0x1c, 0x12, 0x11, 0x1e, 0x10}, // β
+	0xbf: {0x02, 0x04, 0x1f, 0x10, 0x1e, 0x10, 0x1f, 0x00}, // É
+	0xc0: {0x1f, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x00}, // Γ
+	0xc1: {0x04, 0x0a, 0x0a, 0x11, 0x11, 0x11, 0x11, 0x00}, // Λ
+	0xc2: {0x1f, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x00}, // Π
+	0xc3: {0x11, 0x11, 0x0a, 0x04, 0x04, 0x04, 0x04, 0x00}, // Υ
+	0xc4: {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1f, 0x00}, // _
+	0xc5: {0x08, 0x04, 0x1f, 0x10, 0x1e, 0x10, 0x1f, 0x00}, // È
+	0xc6: {0x04, 0x0a, 0x1f, 0x10, 0x1e, 0x10, 0x1f, 0x00}, // Ê
+	0xc7: {0x04, 0x0a, 0x0e, 0x11, 0x1f, 0x10, 0x0e, 0x00}, // ê
+	0xc8: {0x00, 0x00, 0x0e, 0x10, 0x11, 0x0e, 0x04, 0x0c}, // ç
+	0xc9: {0x12, 0x0c, 0x0f, 0x11, 0x0f, 0x01, 0x0e, 0x00}, // ğ
+	0xca: {0x0f, 0x10, 0x0e, 0x01, 0x1e, 0x04, 0x0c, 0x00}, // Ş
+	0xcb: {0x00, 0x0f, 0x10, 0x0e, 0x01, 0x1e, 0x04, 0x0c}, // ş
+	0xcc: {0x04, 0x00, 0x0e, 0x04, 0x04, 0x04, 0x0e, 0x00}, // İ
+	0xcd: {0x00, 0x00, 0x0c, 0x04, 0x04, 0x04, 0x0e, 0x00}, // ı
+	0xce: {0x00, 0x00, 0x08, 0x15, 0x02, 0x00, 0x00, 0x00}, // ~
+	0xcf: {0x00, 0x04, 0x0a, 0x11, 0x0a, 0x04, 0x00, 0x00}, // ◇
+	0xd0: {0x00, 0x1f, 0x1f, 0x1f, 0x1f, 0x1f, 0x00, 0x00}, // ■
+	0xd1: {0x00, 0x00, 0x0e, 0x0e, 0x0e, 0x00, 0x00, 0x00}, // ▪
+	0xd2: {0x00, 0x1f, 0x11, 0x11, 0x11, 0x1f, 0x00, 0x00}, // ▫
+	0xd3: {0x0e, 0x0a, 0x0a, 0x0a, 0x0a, 0x0a, 0x0e, 0x00}, // ▯
+	0xd4: {0x0e, 0x0e, 0x0e, 0x0e, 0x0e, 0x0e, 0x0e, 0x00}, // ▮
+	0xd5: {0x03, 0x04, 0x0e, 0x04, 0x04, 0x04, 0x18, 0x00}, // ƒ
+	0xd6: {0x1f, 0x1f, 0x1f, 0x1f, 0x1f, 0x1f, 0x1f, 0x00}, // █
+	0xd7: {0x1e, 0x1e, 0x1e, 0x1e, 0x1e, 0x1e, 0x1e, 0x00}, // ▊
+	0xd8: {0x1c, 0x1c, 0x1c, 0x1c, 0x1c, 0x1c, 0x1c, 0x00}, // ▋
+	0xd9: {0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x00}, // ▍
+	0xda: {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x00}, // ▏
+	0xdb: {0x1c, 0x12, 0x1c, 0x17, 0x12, 0x12, 0x11, 0x00}, // ₧
+	0xdc: {0x00, 0x00, 0x0e, 0x0a, 0x0e, 0x00, 0x00, 0x00}, // ◦
+	0xdd: {0x00, 0x00, 0x04, 0x0e, 0x04, 0x00, 0x00, 0x00}, // •
+	0xde: {0x04, 0x0e, 0x15, 0x04, 0x04, 0x04, 0x04, 0x00}, // ↑
+	0xdf: {0x00, 0x04, 0x02, 0x1f, 0x02, 0x04, 0x00, 0x00}, // →
+	0xe0: {0x04, 0x04, 0x04, 0x04, 0x15, 0x0e, 0x04, 0x00}, // ↓
+	0xe1: {0x00, 0x04, 0x08, 0x1f, 0x08, 0x04, 0x00, 0x00}, // ←
+	0xe2: {0x02, 0x04, 0x0e, 0x11, 0x1f, 0x11, 0x11, 0x00}, // Á
+	0xe3: {0x02, 0x04, 0x0e, 0x04, 0x04, 0x04, 0x0e, 0x00}, // Í
+	0xe4: {0x02, 0x04, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00}, // Ó
+	0xe5: {0x02, 0x04, 0x11, 0x11, 0x11, 0x11, 0x0e, 0x00}, // Ú
+	0xe6: {0x02, 0x04, 0x11, 0x0a, 0x04, 0x04, 0x04, 0x00}, // Ý
+	0xe7: {0x02, 0x04, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x00}, // á
+	0xe8: {0x02, 0x04, 0x00, 0x0c, 0x04, 0x04, 0x0e, 0x00}, // í
+	0xe9: {0x02, 0x04, 0x00, 0x0e, 0x11, 0x11, 0x0e, 0x00}, // ó
+	0xea: {0x02, 0x04, 0x11, 0x11, 0x11, 0x13, 0x0d, 0x00}, // ú
+	0xeb: {0x02, 0x04, 0x11, 0x11, 0x0f, 0x01, 0x0e, 0x00}, // ý
+	0xec: {0x04, 0x0a, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00}, // Ô
+	0xed: {0x04, 0x0a, 0x00, 0x0e, 0x11, 0x11, 0x0e, 0x00}, // ô
+	0xee: {0x04, 0x0a, 0x15, 0x11, 0x11, 0x11, 0x0e, 0x00}, // Ů
+	0xef: {0x04, 0x0a, 0x04, 0x11, 0x11, 0x13, 0x0d, 0x00}, // ů
+	0xf0: {0x0a, 0x04, 0x0e, 0x11, 0x10, 0x11, 0x0e, 0x00}, // Č
+	0xf1: {0x0a, 0x04, 0x1f, 0x10, 0x1e, 0x10, 0x1f, 0x00}, // Ě
+	0xf2: {0x0a, 0x04, 0x1e, 0x11, 0x1e, 0x12, 0x11, 0x00}, // Ř
+	0xf3: {0x0a, 0x04, 0x0f, 0x10, 0x0e, 0x01, 0x1e, 0x00}, // Š
+	0xf4: {0x0a, 0x04, 0x1f, 0x02, 0x04, 0x08, 0x1f, 0x00}, // Ž
+	0xf5: {0x0a, 0x04, 0x0e, 0x10, 0x10, 0x11, 0x0e, 0x00}, // č
+	0xf6: {0x0a, 0x04, 0x0e, 0x11, 0x1f, 0x10, 0x0e, 0x00}, // ě
+	0xf7: {0x0a, 0x04, 0x16, 0x19, 0x10, 0x10, 0x10, 0x00}, // ř
+	0xf8: {0x0a, 0x04, 0x0e, 0x10, 0x0e, 0x01, 0x1e, 0x00}, // š
+	0xf9: {0x0a, 0x04, 0x1f, 0x02, 0x04, 0x08, 0x1f, 0x00}, // ž
+	0xfa: {0x0e, 0x08, 0x08, 0x08, 0x08, 0x08, 0x0e, 0x00}, // [
+	0xfb: {0x00, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00, 0x00}, // \
+	0xfc: {0x0e, 0x02, 0x02, 0x02, 0x02, 0x02, 0x0e, 0x00}, // ]
+	0xfd: {0x02, 0x04, 0x04, 0x08, 0x04, 0x04, 0x02, 0x00}, // {
+	0xfe: {0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x00}, // |
+	0xff: {0x08, 0x04, 0x04, 0x02, 0x04, 0x04, 0x08, 0x00}, // }
+}
+
+// glyphFont holds bitmaps for characters that the character ROM lacks, in the
+// style of the ROM's own accented letters. GlyphManager loads them into CGRAM
+// on demand.
+var glyphFont = map[rune]Sprite{
+	'À': {0x08, 0x04, 0x0e, 0x11, 0x1f, 0x11, 0x11, 0x00},
+	'Â': {0x04, 0x0a, 0x0e, 0x11, 0x1f, 0x11, 0x11, 0x00},
+	'Ã': {0x0d, 0x12, 0x0e, 0x11, 0x1f, 0x11, 0x11, 0x00},
+	'Ë': {0x0a, 0x00, 0x1f, 0x10, 0x1e, 0x10, 0x1f, 0x00},
+	'Ì': {0x08, 0x04, 0x0e, 0x04, 0x04, 0x04, 0x0e, 0x00},
+	'Î': {0x04, 0x0a, 0x0e, 0x04, 0x04, 0x04, 0x0e, 0x00},
+	'Ï': {0x0a, 0x00, 0x0e, 0x04, 0x04, 0x04, 0x0e, 0x00},
+	'Ð': {0x1c, 0x12, 0x11, 0x1d, 0x11, 0x12, 0x1c, 0x00},
+	'Ò': {0x08, 0x04, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'Õ': {0x0d, 0x12, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'Ù': {0x08, 0x04, 0x11, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'Û': {0x04, 0x0a, 0x11, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'Þ': {0x10, 0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x00},
+	'â': {0x04, 0x0a, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x00},
+	'ã': {0x0d, 0x12, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x00},
+	'ë': {0x0a, 0x00, 0x0e, 0x11, 0x1f, 0x10, 0x0e, 0x00},
+	'î': {0x04, 0x0a, 0x0c, 0x04, 0x04, 0x04, 0x0e, 0x00},
+	'ï': {0x0a, 0x00, 0x0c, 0x04, 0x04, 0x04, 0x0e, 0x00},
+	'ð': {0x0a, 0x04, 0x0a, 0x01, 0x0f, 0x11, 0x0e, 0x00},
+	'õ': {0x0d, 0x12, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'û': {0x04, 0x0a, 0x11, 0x11, 0x11, 0x13, 0x0d, 0x00},
+	'þ': {0x10, 0x10, 0x1e, 0x11, 0x1e, 0x10, 0x10, 0x00},
+	'ÿ': {0x0a, 0x00, 0x11, 0x11, 0x0f, 0x01, 0x0e, 0x00},
+	'Ā': {0x0e, 0x00, 0x0e, 0x11, 0x1f, 0x11, 0x11, 0x00},
+	'ā': {0x0e, 0x00, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x00},
+	'Ă': {0x11, 0x0e, 0x0e, 0x11, 0x1f, 0x11, 0x11, 0x00},
+	'ă': {0x11, 0x0e, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x00},
+	'Ą': {0x0e, 0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x03},
+	'ą': {0x00, 0x00, 0x0e, 0x01, 0x0f, 0x11, 0x0f, 0x03},
+	'Ć': {0x02, 0x04, 0x0e, 0x11, 0x10, 0x11, 0x0e, 0x00},
+	'ć': {0x02, 0x04, 0x0e, 0x10, 0x10, 0x11, 0x0e, 0x00},
+	'Ď': {0x0a, 0x04, 0x1e, 0x11, 0x11, 0x11, 0x1e, 0x00},
+	'ď': {0x03, 0x02, 0x0e, 0x12, 0x12, 0x12, 0x0e, 0x00},
+	'Đ': {0x1c, 0x12, 0x11, 0x1d, 0x11, 0x12, 0x1c, 0x00},
+	'đ': {0x02, 0x07, 0x02, 0x0e, 0x12, 0x12, 0x0e, 0x00},
+	'Ē': {0x0e, 0x00, 0x1f, 0x10, 0x1e, 0x10, 0x1f, 0x00},
+	'ē': {0x0e, 0x00, 0x0e, 0x11, 0x1f, 0x10, 0x0e, 0x00},
+	'Ė': {0x04, 0x00, 0x1f, 0x10, 0x1e, 0x10, 0x1f, 0x00},
+	'ė': {0x04, 0x00, 0x0e, 0x11, 0x1f, 0x10, 0x0e, 0x00},
+	'Ę': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f, 0x03},
+	'ę': {0x00, 0x00, 0x0e, 0x11, 0x1f, 0x10, 0x0e, 0x03},
+	'Ğ': {0x11, 0x0e, 0x0f, 0x10, 0x13, 0x11, 0x0f, 0x00},
+	'Ī': {0x0e, 0x00, 0x0e, 0x04, 0x04, 0x04, 0x0e, 0x00},
+	'ī': {0x0e, 0x00, 0x0c, 0x04, 0x04, 0x04, 0x0e, 0x00},
+	'Į': {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e, 0x03},
+	'į': {0x00, 0x00, 0x0c, 0x04, 0x04, 0x04, 0x0e, 0x03},
+	'Ĺ': {0x02, 0x04, 0x10, 0x10, 0x10, 0x10, 0x1f, 0x00},
+	'ĺ': {0x02, 0x04, 0x0c, 0x04, 0x04, 0x04, 0x0e, 0x00},
+	'Ľ': {0x12, 0x12, 0x10, 0x10, 0x10, 0x10, 0x1f, 0x00},
+	'ľ': {0x0d, 0x05, 0x04, 0x04, 0x04, 0x04, 0x0e, 0x00},
+	'Ł': {0x10, 0x10, 0x14, 0x18, 0x10, 0x10, 0x1f, 0x00},
+	'ł': {0x0c, 0x04, 0x06, 0x0c, 0x04, 0x04, 0x0e, 0x00},
+	'Ń': {0x02, 0x04, 0x11, 0x19, 0x15, 0x13, 0x11, 0x00},
+	'ń': {0x02, 0x04, 0x16, 0x19, 0x11, 0x11, 0x11, 0x00},
+	'Ň': {0x0a, 0x04, 0x11, 0x19, 0x15, 0x13, 0x11, 0x00},
+	'ň': {0x0a, 0x04, 0x16, 0x19, 0x11, 0x11, 0x11, 0x00},
+	'Ō': {0x0e, 0x00, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'ō': {0x0e, 0x00, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'Ő': {0x09, 0x12, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'ő': {0x09, 0x12, 0x0e, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'Œ': {0x0f, 0x14, 0x14, 0x17, 0x14, 0x14, 0x0f, 0x00},
+	'œ': {0x00, 0x00, 0x0a, 0x15, 0x17, 0x14, 0x0b, 0x00},
+	'Ŕ': {0x02, 0x04, 0x1e, 0x11, 0x1e, 0x12, 0x11, 0x00},
+	'ŕ': {0x02, 0x04, 0x16, 0x19, 0x10, 0x10, 0x10, 0x00},
+	'Ś': {0x02, 0x04, 0x0f, 0x10, 0x0e, 0x01, 0x1e, 0x00},
+	'ś': {0x02, 0x04, 0x0e, 0x10, 0x0e, 0x01, 0x1e, 0x00},
+	'Ţ': {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'ţ': {0x08, 0x08, 0x1c, 0x08, 0x08, 0x09, 0x06, 0x04},
+	'Ť': {0x0a, 0x04, 0x1f, 0x04, 0x04, 0x04, 0x04, 0x00},
+	'ť': {0x0a, 0x0a, 0x1c, 0x08, 0x08, 0x09, 0x06, 0x00},
+	'Ū': {0x0e, 0x00, 0x11, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'ū': {0x0e, 0x00, 0x11, 0x11, 0x11, 0x13, 0x0d, 0x00},
+	'Ű': {0x09, 0x12, 0x11, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'ű': {0x09, 0x12, 0x11, 0x11, 0x11, 0x13, 0x0d, 0x00},
+	'Ų': {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e, 0x03},
+	'ų': {0x00, 0x00, 0x11, 0x11, 0x11, 0x13, 0x0d, 0x03},
+	'Ÿ': {0x0a, 0x00, 0x11, 0x0a, 0x04, 0x04, 0x04, 0x00},
+	'Ź': {0x02, 0x04, 0x1f, 0x02, 0x04, 0x08, 0x1f, 0x00},
+	'ź': {0x02, 0x04, 0x1f, 0x02, 0x04, 0x08, 0x1f, 0x00},
+	'Ż': {0x04, 0x00, 0x1f, 0x02, 0x04, 0x08, 0x1f, 0x00},
+	'ż': {0x04, 0x00, 0x1f, 0x02, 0x04, 0x08, 0x1f, 0x00},
+	'Ț': {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'ț': {0x08, 0x08, 0x1c, 0x08, 0x08, 0x09, 0x06, 0x04},
+	'γ': {0x00, 0x00, 0x11, 0x0a, 0x04, 0x04, 0x04, 0x00},
+	'η': {0x00, 0x00, 0x16, 0x19, 0x11, 0x11, 0x01, 0x00},
+	'θ': {0x04, 0x0a, 0x11, 0x1f, 0x11, 0x0a, 0x04, 0x00},
+	'ι': {0x00, 0x00, 0x08, 0x08, 0x08, 0x0a, 0x04, 0x00},
+	'κ': {0x00, 0x00, 0x12, 0x14, 0x18, 0x14, 0x12, 0x00},
+	'ν': {0x00, 0x00, 0x11, 0x11, 0x12, 0x14, 0x18, 0x00},
+	'ξ': {0x0f, 0x10, 0x0e, 0x10, 0x0f, 0x01, 0x06, 0x00},
+	'ρ': {0x00, 0x00, 0x0e, 0x11, 0x1e, 0x10, 0x10, 0x00},
+	'ς': {0x00, 0x00, 0x0f, 0x10, 0x0e, 0x01, 0x06, 0x00},
+	'σ': {0x00, 0x00, 0x0f, 0x12, 0x11, 0x11, 0x0e, 0x00},
+	'υ': {0x00, 0x00, 0x12, 0x11, 0x11, 0x11, 0x0e, 0x00},
+	'φ': {0x00, 0x04, 0x0e, 0x15, 0x15, 0x0e, 0x04, 0x00},
+	'χ': {0x00, 0x00, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x00},
+	'ψ': {0x00, 0x00, 0x15, 0x15, 0x0e, 0x04, 0x04, 0x00},
+	'ω': {0x00, 0x00, 0x0a, 0x11, 0x15, 0x15, 0x0a, 0x00},
+	'…': {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x15, 0x00},
+	'€': {0x06, 0x09, 0x1c, 0x08, 0x1c, 0x09, 0x06, 0x00},
+}
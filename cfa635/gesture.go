@@ -0,0 +1,333 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635
+
+import (
+	"time"
+)
+
+// Gesture is a way of using the keys that Gestures recognizes.
+type Gesture int
+
+const (
+	_ Gesture = iota
+
+	// ShortPress is a key pressed and released before the long-press
+	// threshold.
+	ShortPress
+
+	// LongPress is a key held down for the long-press threshold.
+	LongPress
+
+	// Repeat is a key still held down one repeat interval after its
+	// LongPress or its last Repeat.
+	Repeat
+
+	// DoublePress is two short presses of a key in quick succession. While
+	// a key could still make a DoublePress, Gestures holds back its
+	// ShortPress, so a DoublePress replaces both ShortPresses.
+	DoublePress
+
+	// Chord is a key pressed while another is already held down. Neither
+	// key makes any other gesture until it is released.
+	Chord
+)
+
+func (g Gesture) String() string {
+	switch g {
+	case ShortPress:
+		return "short press"
+	case LongPress:
+		return "long press"
+	case Repeat:
+		return "repeat"
+	case DoublePress:
+		return "double press"
+	case Chord:
+		return "chord"
+	}
+	return "unknown gesture"
+}
+
+// GestureEvent reports a gesture.
+type GestureEvent struct {
+	Gesture Gesture
+	K       Key
+	K2      Key       // For a Chord, the key pressed second
+	Time    time.Time // When the gesture was recognized
+}
+
+type gestures struct {
+	longPress   time.Duration
+	repeat      time.Duration
+	doublePress time.Duration
+	doubleKeys  uint8 // Bit k is set if key k can make a DoublePress
+	maxHold     time.Duration
+
+	state [ExitButton + 1]keyState // Indexed by Key
+	out   chan<- *GestureEvent
+}
+
+// A GestureOption configures Gestures.
+type GestureOption func(*gestures)
+
+// WithLongPress sets how long a key must be held to make a LongPress. The
+// default is 600 ms.
+func WithLongPress(d time.Duration) GestureOption {
+	return func(g *gestures) { g.longPress = d }
+}
+
+// WithRepeat sets the interval between Repeat gestures while a key is held.
+// The default is 150 ms; zero disables Repeat.
+func WithRepeat(d time.Duration) GestureOption {
+	return func(g *gestures) { g.repeat = d }
+}
+
+// WithDoublePress sets the longest time between the release of a short press
+// and the next press of the same key that still makes a DoublePress. The
+// default is 300 ms; zero disables DoublePress.
+//
+// Each ShortPress of a key that can make a DoublePress arrives this long after
+// the key is released, so use WithDoublePressKeys to limit the delay to the
+// keys that need it.
+func WithDoublePress(d time.Duration) GestureOption {
+	return func(g *gestures) { g.doublePress = d }
+}
+
+// WithDoublePressKeys limits DoublePress to the given keys. By default, every
+// key can make a DoublePress.
+func WithDoublePressKeys(keys ...Key) GestureOption {
+	return func(g *gestures) {
+		g.doubleKeys = 0
+		for _, k := range keys {
+			if k > 0 && k <= ExitButton {
+				g.doubleKeys |= 1 << k
+			}
+		}
+	}
+}
+
+// WithMaxHold sets how long a key can be held before Gestures decides its
+// release report was lost and treats it as released, without making a gesture.
+// The default is 10 s; zero lets keys be held forever.
+func WithMaxHold(d time.Duration) GestureOption {
+	return func(g *gestures) { g.maxHold = d }
+}
+
+// keyState tracks one key for Gestures.
+type keyState struct {
+	down      time.Time // When the key was pressed; zero if it's up
+	next      time.Time // When to send the next LongPress or Repeat
+	long      bool      // The key has made a LongPress since it was pressed
+	chorded   bool      // The key is part of a Chord
+	double    bool      // The current press began soon enough to be a DoublePress
+	lastShort time.Time // When the last short press ended
+	pending   bool      // The ShortPress ending at lastShort is held back
+}
+
+// Gestures recognizes gestures in key activity, such as the KeyActivity
+// reports from a Subscription. It reads from keys until keys is closed and then
+// closes the returned channel.
+//
+// Because KeyActivity has no timestamps, Gestures times key activity by when
+// it arrives, so keys should not be buffered far behind the CFA635.
+func Gestures(keys <-chan *KeyActivity, opts ...GestureOption) <-chan *GestureEvent {
+	g := gestures{
+		longPress:   600 * time.Millisecond,
+		repeat:      150 * time.Millisecond,
+		doublePress: 300 * time.Millisecond,
+		doubleKeys:  ^uint8(0),
+		maxHold:     10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&g)
+	}
+
+	out := make(chan *GestureEvent, 16)
+	g.out = out
+	go g.run(keys)
+	return out
+}
+
+func (g *gestures) send(gesture Gesture, k, k2 Key, now time.Time) {
+	g.out <- &GestureEvent{Gesture: gesture, K: k, K2: k2, Time: now}
+}
+
+// canDouble reports whether k can make a DoublePress.
+func (g *gestures) canDouble(k Key) bool {
+	return g.doublePress > 0 && g.doubleKeys&(1<<k) != 0
+}
+
+// flush sends k's held-back ShortPress, if it has one, and ends its chance to
+// make a DoublePress.
+func (g *gestures) flush(k Key, now time.Time) {
+	s := &g.state[k]
+	if s.pending {
+		g.send(ShortPress, k, 0, now)
+	}
+	s.pending, s.lastShort, s.double = false, time.Time{}, false
+}
+
+func (g *gestures) run(keys <-chan *KeyActivity) {
+	defer close(g.out)
+
+	state := &g.state
+	for {
+		// Wait for key activity, the next LongPress or Repeat, a key to
+		// reach the maximum hold, or a held-back ShortPress to become
+		// due.
+		var next time.Time
+		for k := range state {
+			s := &state[k]
+			if s.pending && s.down.IsZero() {
+				next = earliest(next, s.lastShort.Add(g.doublePress))
+			}
+			if s.down.IsZero() {
+				continue
+			}
+			next = earliest(next, s.next)
+			if g.maxHold > 0 {
+				next = earliest(next, s.down.Add(g.maxHold))
+			}
+		}
+		var timeout <-chan time.Time
+		if !next.IsZero() {
+			timeout = time.After(time.Until(next))
+		}
+
+		select {
+		case a, ok := <-keys:
+			if !ok {
+				for k := range state {
+					g.flush(Key(k), time.Now())
+				}
+				return
+			}
+			if a.K <= 0 || int(a.K) >= len(state) {
+				continue
+			}
+			now := time.Now()
+			if a.Pressed {
+				g.press(a.K, now)
+			} else {
+				g.release(a.K, now)
+			}
+
+		case now := <-timeout:
+			for k := range state {
+				s := &state[k]
+				if s.down.IsZero() {
+					if s.pending && !s.lastShort.Add(g.doublePress).After(now) {
+						g.flush(Key(k), now)
+					}
+					continue
+				}
+				if g.maxHold > 0 && !s.down.Add(g.maxHold).After(now) {
+					// The CFA635 only reports changes, so a
+					// release lost on the link would otherwise
+					// leave the key repeating forever.
+					g.flush(Key(k), now)
+					*s = keyState{}
+					continue
+				}
+				if s.next.IsZero() || s.next.After(now) {
+					continue
+				}
+				if s.long {
+					g.send(Repeat, Key(k), 0, now)
+				} else {
+					// A second press held down isn't a
+					// DoublePress, so the first press was a
+					// ShortPress after all.
+					g.flush(Key(k), now)
+					s.long = true
+					g.send(LongPress, Key(k), 0, now)
+				}
+				s.next = time.Time{}
+				if g.repeat > 0 {
+					s.next = now.Add(g.repeat)
+				}
+			}
+		}
+	}
+}
+
+func (g *gestures) press(k Key, now time.Time) {
+	s := &g.state[k]
+	if !s.down.IsZero() {
+		return // A repeated press report
+	}
+
+	// Pressing another key ends any chance of a DoublePress, so send the
+	// ShortPresses that were held back for one, in order.
+	for h := range g.state {
+		if Key(h) != k {
+			g.flush(Key(h), now)
+		}
+	}
+	double := g.canDouble(k) && s.pending && now.Sub(s.lastShort) <= g.doublePress
+	if !double {
+		g.flush(k, now)
+	}
+	*s = keyState{
+		down:      now,
+		next:      now.Add(g.longPress),
+		double:    double,
+		lastShort: s.lastShort,
+		pending:   s.pending,
+	}
+
+	// Pressing a key while another is held makes a chord, unless the other
+	// key has already made a LongPress.
+	for h := range g.state {
+		o := &g.state[h]
+		if Key(h) == k || o.down.IsZero() || o.long || o.chorded {
+			continue
+		}
+		g.flush(k, now)
+		o.chorded, s.chorded = true, true
+		o.next, s.next = time.Time{}, time.Time{}
+		g.send(Chord, Key(h), k, now)
+		return
+	}
+}
+
+func (g *gestures) release(k Key, now time.Time) {
+	s := &g.state[k]
+	if s.down.IsZero() {
+		return
+	}
+	switch {
+	case s.chorded || s.long:
+		g.flush(k, now)
+	case s.double:
+		s.pending, s.lastShort = false, time.Time{}
+		g.send(DoublePress, k, 0, now)
+	case g.canDouble(k):
+		s.pending, s.lastShort = true, now
+	default:
+		s.lastShort = time.Time{}
+		g.send(ShortPress, k, 0, now)
+	}
+	s.down, s.next = time.Time{}, time.Time{}
+}
+
+// earliest returns whichever of a and b is earlier, ignoring zero times.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,257 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"testing"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+// never is longer than any of these tests run, for turning off timed gestures.
+const never = time.Hour
+
+// keypad feeds synthetic key activity to Gestures.
+type keypad struct {
+	t      *testing.T
+	keys   chan *cfa635.KeyActivity
+	events <-chan *cfa635.GestureEvent
+}
+
+func newKeypad(t *testing.T, opts ...cfa635.GestureOption) *keypad {
+	keys := make(chan *cfa635.KeyActivity)
+	p := &keypad{t, keys, cfa635.Gestures(keys, opts...)}
+	t.Cleanup(func() { close(keys) })
+	return p
+}
+
+func (p *keypad) press(k cfa635.Key)   { p.keys <- &cfa635.KeyActivity{K: k, Pressed: true} }
+func (p *keypad) release(k cfa635.Key) { p.keys <- &cfa635.KeyActivity{K: k, Pressed: false} }
+
+// expect waits for the next gesture and checks that it's g on k.
+func (p *keypad) expect(g cfa635.Gesture, k cfa635.Key) *cfa635.GestureEvent {
+	p.t.Helper()
+	select {
+	case e := <-p.events:
+		if e.Gesture != g || e.K != k {
+			p.t.Fatalf("got %v of key %d, want %v of key %d", e.Gesture, e.K, g, k)
+		}
+		return e
+	case <-time.After(time.Second):
+		p.t.Fatalf("got nothing, want %v of key %d", g, k)
+	}
+	return nil
+}
+
+// quiet checks that no gesture arrives for d.
+func (p *keypad) quiet(d time.Duration) {
+	p.t.Helper()
+	select {
+	case e := <-p.events:
+		p.t.Fatalf("got %v of key %d, want nothing", e.Gesture, e.K)
+	case <-time.After(d):
+	}
+}
+
+func TestShortPress(t *testing.T) {
+	p := newKeypad(t, cfa635.WithLongPress(never), cfa635.WithDoublePress(0))
+	p.press(cfa635.UpButton)
+	p.release(cfa635.UpButton)
+	p.expect(cfa635.ShortPress, cfa635.UpButton)
+	p.press(cfa635.UpButton)
+	p.release(cfa635.UpButton)
+	p.expect(cfa635.ShortPress, cfa635.UpButton)
+}
+
+func TestLongPressRepeats(t *testing.T) {
+	p := newKeypad(t, cfa635.WithLongPress(20*time.Millisecond), cfa635.WithRepeat(10*time.Millisecond))
+	p.press(cfa635.RightButton)
+	p.expect(cfa635.LongPress, cfa635.RightButton)
+	p.expect(cfa635.Repeat, cfa635.RightButton)
+	p.expect(cfa635.Repeat, cfa635.RightButton)
+	p.release(cfa635.RightButton)
+	// Repeats sent before the release may still be in the channel.
+	for done := false; !done; {
+		select {
+		case e := <-p.events:
+			if e.Gesture != cfa635.Repeat {
+				t.Fatalf("got %v after release, want nothing", e.Gesture)
+			}
+		case <-time.After(50 * time.Millisecond):
+			done = true
+		}
+	}
+}
+
+func TestLongPressWithoutRepeat(t *testing.T) {
+	p := newKeypad(t, cfa635.WithLongPress(10*time.Millisecond), cfa635.WithRepeat(0))
+	p.press(cfa635.EnterButton)
+	p.expect(cfa635.LongPress, cfa635.EnterButton)
+	p.quiet(50 * time.Millisecond)
+	p.release(cfa635.EnterButton)
+	p.quiet(50 * time.Millisecond)
+}
+
+func TestDoublePress(t *testing.T) {
+	const window = 100 * time.Millisecond
+	p := newKeypad(t, cfa635.WithLongPress(never), cfa635.WithDoublePress(window))
+	p.press(cfa635.EnterButton)
+	p.release(cfa635.EnterButton)
+	p.press(cfa635.EnterButton)
+	p.release(cfa635.EnterButton)
+	p.expect(cfa635.DoublePress, cfa635.EnterButton)
+
+	// A third press starts over, and its ShortPress waits out the window.
+	p.press(cfa635.EnterButton)
+	released := time.Now()
+	p.release(cfa635.EnterButton)
+	p.expect(cfa635.ShortPress, cfa635.EnterButton)
+	if d := time.Since(released); d < window {
+		t.Errorf("ShortPress arrived %v after release, want at least %v", d, window)
+	}
+}
+
+func TestDoublePressTimesOut(t *testing.T) {
+	p := newKeypad(t, cfa635.WithLongPress(never), cfa635.WithDoublePress(10*time.Millisecond))
+	p.press(cfa635.EnterButton)
+	p.release(cfa635.EnterButton)
+	p.expect(cfa635.ShortPress, cfa635.EnterButton)
+	p.press(cfa635.EnterButton)
+	p.release(cfa635.EnterButton)
+	p.expect(cfa635.ShortPress, cfa635.EnterButton)
+}
+
+func TestDoublePressKeys(t *testing.T) {
+	p := newKeypad(t, cfa635.WithLongPress(never), cfa635.WithDoublePress(never), cfa635.WithDoublePressKeys(cfa635.EnterButton))
+	// Up can't make a DoublePress, so its ShortPresses aren't held back.
+	p.press(cfa635.UpButton)
+	p.release(cfa635.UpButton)
+	p.expect(cfa635.ShortPress, cfa635.UpButton)
+	p.press(cfa635.UpButton)
+	p.release(cfa635.UpButton)
+	p.expect(cfa635.ShortPress, cfa635.UpButton)
+
+	p.press(cfa635.EnterButton)
+	p.release(cfa635.EnterButton)
+	p.quiet(50 * time.Millisecond)
+	p.press(cfa635.EnterButton)
+	p.release(cfa635.EnterButton)
+	p.expect(cfa635.DoublePress, cfa635.EnterButton)
+}
+
+func TestHeldSecondPressIsNotDouble(t *testing.T) {
+	p := newKeypad(t, cfa635.WithLongPress(20*time.Millisecond), cfa635.WithRepeat(0), cfa635.WithDoublePress(never))
+	p.press(cfa635.EnterButton)
+	p.release(cfa635.EnterButton)
+	p.press(cfa635.EnterButton)
+	p.expect(cfa635.ShortPress, cfa635.EnterButton)
+	p.expect(cfa635.LongPress, cfa635.EnterButton)
+	p.release(cfa635.EnterButton)
+	p.quiet(50 * time.Millisecond)
+}
+
+func TestOtherKeySendsHeldShortPress(t *testing.T) {
+	p := newKeypad(t, cfa635.WithLongPress(never), cfa635.WithDoublePress(never))
+	p.press(cfa635.UpButton)
+	p.release(cfa635.UpButton)
+	p.press(cfa635.DownButton)
+	p.expect(cfa635.ShortPress, cfa635.UpButton)
+	p.release(cfa635.DownButton)
+	p.quiet(50 * time.Millisecond)
+}
+
+func TestGesturesSendsHeldShortPressOnClose(t *testing.T) {
+	keys := make(chan *cfa635.KeyActivity)
+	events := cfa635.Gestures(keys, cfa635.WithDoublePress(never))
+	keys <- &cfa635.KeyActivity{K: cfa635.UpButton, Pressed: true}
+	keys <- &cfa635.KeyActivity{K: cfa635.UpButton, Pressed: false}
+	close(keys)
+	if e := <-events; e == nil || e.Gesture != cfa635.ShortPress {
+		t.Errorf("got %v, want a ShortPress", e)
+	}
+}
+
+func TestChord(t *testing.T) {
+	p := newKeypad(t, cfa635.WithLongPress(never))
+	p.press(cfa635.UpButton)
+	p.press(cfa635.DownButton)
+	if e := p.expect(cfa635.Chord, cfa635.UpButton); e.K2 != cfa635.DownButton {
+		t.Errorf("chord K2 = %d, want %d", e.K2, cfa635.DownButton)
+	}
+	p.release(cfa635.DownButton)
+	p.release(cfa635.UpButton)
+	p.quiet(50 * time.Millisecond)
+}
+
+func TestNoChordAfterLongPress(t *testing.T) {
+	p := newKeypad(t, cfa635.WithLongPress(10*time.Millisecond), cfa635.WithRepeat(0))
+	p.press(cfa635.UpButton)
+	p.expect(cfa635.LongPress, cfa635.UpButton)
+	p.press(cfa635.DownButton)
+	p.release(cfa635.DownButton)
+	p.expect(cfa635.ShortPress, cfa635.DownButton)
+	p.release(cfa635.UpButton)
+	p.quiet(50 * time.Millisecond)
+}
+
+func TestMaxHoldDropsLostRelease(t *testing.T) {
+	const (
+		longPress = 10 * time.Millisecond
+		repeat    = 10 * time.Millisecond
+		maxHold   = 60 * time.Millisecond
+	)
+	p := newKeypad(t, cfa635.WithLongPress(longPress), cfa635.WithRepeat(repeat), cfa635.WithMaxHold(maxHold), cfa635.WithDoublePress(0))
+	p.press(cfa635.DownButton)
+	p.expect(cfa635.LongPress, cfa635.DownButton)
+
+	// The release never arrives, so the repeats must stop on their own.
+	var repeats int
+	for done := false; !done; {
+		select {
+		case e := <-p.events:
+			if e.Gesture != cfa635.Repeat || e.K != cfa635.DownButton {
+				t.Fatalf("got %v of key %d, want a repeat", e.Gesture, e.K)
+			}
+			repeats++
+		case <-time.After(5 * maxHold):
+			done = true
+		}
+	}
+	if max := int((maxHold - longPress) / repeat); repeats > max {
+		t.Errorf("got %d repeats, want at most %d", repeats, max)
+	}
+
+	// A late release is ignored, and the key works normally afterward.
+	p.release(cfa635.DownButton)
+	p.quiet(50 * time.Millisecond)
+	p.press(cfa635.DownButton)
+	p.release(cfa635.DownButton)
+	p.expect(cfa635.ShortPress, cfa635.DownButton)
+}
+
+func TestGesturesClosesWithKeys(t *testing.T) {
+	keys := make(chan *cfa635.KeyActivity)
+	events := cfa635.Gestures(keys)
+	close(keys)
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("got a gesture, want the channel closed")
+		}
+	case <-time.After(time.Second):
+		t.Error("Gestures didn't close its channel")
+	}
+}
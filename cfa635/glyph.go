@@ -0,0 +1,182 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635
+
+import (
+	"golang.org/x/text/unicode/norm"
+)
+
+// CharacterSetter loads sprites into CGRAM. *Module implements it, as does
+// anything else with a compatible SetCharacter method.
+type CharacterSetter interface {
+	SetCharacter(i int, data *[8]byte) error
+}
+
+// GlyphManager shares CGRAM among the sprites and missing characters that a
+// program wants to show, loading each into a slot only while it's needed.
+//
+// To draw a frame, request every sprite the frame needs with Sprite and encode
+// its text with Encode. Then, before sending the frame to the CFA635, pass it
+// to Commit, which loads the requested bitmaps and counts how many visible
+// cells use each slot.
+//
+// When a request needs a slot, GlyphManager reuses one that already holds the
+// same bitmap if it can. Otherwise, it takes an empty slot, or else the least
+// recently requested slot that no visible cell uses, or else the least recently
+// requested slot that the current frame hasn't asked for. Slots that the
+// current frame has asked for are never reassigned.
+type GlyphManager struct {
+	slots []glyphSlot
+	epoch uint64 // Number of frames committed, plus 1
+}
+
+type glyphSlot struct {
+	c       byte // The character that displays this slot
+	bitmap  Sprite
+	used    bool   // bitmap is meaningful
+	loaded  bool   // bitmap is in CGRAM
+	refs    int    // Visible cells showing this slot as of the last Commit
+	lastUse uint64 // Epoch of the last request for this slot
+}
+
+// NewGlyphManager creates a GlyphManager that allocates the given CGRAM slots,
+// which must be between 0 and 7, inclusive. With no arguments, it allocates all
+// eight. The GlyphManager assumes that it has exclusive use of its slots and
+// that their contents are unknown.
+func NewGlyphManager(slots ...int) *GlyphManager {
+	if len(slots) == 0 {
+		slots = []int{0, 1, 2, 3, 4, 5, 6, 7}
+	}
+	g := &GlyphManager{epoch: 1}
+	for _, i := range slots {
+		if i < 0 || i > 7 {
+			panic(ErrCGRAM)
+		}
+		g.slots = append(g.slots, glyphSlot{c: byte(i)})
+	}
+	return g
+}
+
+// Sprite requests a slot for a bitmap and returns the character that will
+// display it once the frame is committed. If every slot is already in use by
+// the current frame, Sprite returns false.
+func (g *GlyphManager) Sprite(bitmap *Sprite) (byte, bool) {
+	var victim *glyphSlot
+	for i := range g.slots {
+		s := &g.slots[i]
+		if s.used && s.bitmap == *bitmap {
+			s.lastUse = g.epoch
+			return s.c, true
+		}
+		if s.used && s.lastUse == g.epoch {
+			continue
+		}
+		if victim == nil || evictBefore(s, victim) {
+			victim = s
+		}
+	}
+	if victim == nil {
+		return 0, false
+	}
+
+	*victim = glyphSlot{c: victim.c, bitmap: *bitmap, used: true, lastUse: g.epoch}
+	return victim.c, true
+}
+
+// evictBefore reports whether a should be reassigned in preference to b.
+func evictBefore(a, b *glyphSlot) bool {
+	if a.used != b.used {
+		return !a.used
+	}
+	if (a.refs == 0) != (b.refs == 0) {
+		return a.refs == 0
+	}
+	return a.lastUse < b.lastUse
+}
+
+// Encode converts UTF-8 to the CFA635 display character set like
+// NewTransliterator, except that it first tries to load characters missing from
+// the character ROM into CGRAM from a bundled font. Like NewTransliterator,
+// Encode may not produce one byte per code point.
+//
+// Encode requests slots for all of s, whether or not it ends up on the display,
+// so when slots are scarce, encode only the text that will be visible.
+func (g *GlyphManager) Encode(s string) []byte {
+	var r []byte
+	for _, c := range norm.NFC.String(s) {
+		if b, ok := exact(c); ok {
+			r = append(r, b)
+			continue
+		}
+		if bitmap, ok := glyphFont[c]; ok {
+			if b, ok := g.Sprite(&bitmap); ok {
+				r = append(r, b)
+				continue
+			}
+		}
+		r = transliterate1(r, c)
+	}
+	return r
+}
+
+// Commit finishes a frame. It counts the cells in visible that show each slot
+// and loads the bitmaps that visible cells need but CGRAM doesn't yet hold. If
+// loading fails, Commit returns the error, and the next Commit tries again.
+func (g *GlyphManager) Commit(s CharacterSetter, visible [][]byte) error {
+	g.epoch++
+
+	for i := range g.slots {
+		g.slots[i].refs = 0
+	}
+	for _, row := range visible {
+		for _, c := range row {
+			if c >= 0x10 {
+				continue
+			}
+			if slot := g.slot(c & 0x07); slot != nil {
+				slot.refs++
+			}
+		}
+	}
+
+	for i := range g.slots {
+		slot := &g.slots[i]
+		if !slot.used || slot.loaded || slot.refs == 0 {
+			continue
+		}
+		if err := s.SetCharacter(int(slot.c), (*[8]byte)(&slot.bitmap)); err != nil {
+			return err
+		}
+		slot.loaded = true
+	}
+	return nil
+}
+
+// Invalidate tells the GlyphManager that its slots' contents are unknown, so
+// the next Commit must reload every visible slot.
+func (g *GlyphManager) Invalidate() {
+	for i := range g.slots {
+		g.slots[i].loaded = false
+	}
+}
+
+func (g *GlyphManager) slot(c byte) *glyphSlot {
+	for i := range g.slots {
+		if g.slots[i].c == c {
+			return &g.slots[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+// cgram records what a GlyphManager loads.
+type cgram struct {
+	loaded []int // Slots loaded since the last call to take
+	data   [8][8]byte
+	err    error
+}
+
+func (m *cgram) SetCharacter(i int, data *[8]byte) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.loaded = append(m.loaded, i)
+	m.data[i] = *data
+	return nil
+}
+
+// take returns and forgets the slots loaded since the last call.
+func (m *cgram) take() []int {
+	r := m.loaded
+	m.loaded = nil
+	return r
+}
+
+// sprite requests a slot for s and fails the test if there isn't one.
+func sprite(t *testing.T, g *cfa635.GlyphManager, s cfa635.Sprite) byte {
+	t.Helper()
+	c, ok := g.Sprite(&s)
+	if !ok {
+		t.Fatalf("no slot for\n%v", s)
+	}
+	return c
+}
+
+func TestGlyphManagerReusesBitmaps(t *testing.T) {
+	g := cfa635.NewGlyphManager()
+	a := sprite(t, g, *ramp)
+	b := sprite(t, g, ramp.Invert())
+	if a == b {
+		t.Errorf("different sprites share character %d", a)
+	}
+	if again := sprite(t, g, *ramp); again != a {
+		t.Errorf("requesting a sprite again gave character %d, want %d", again, a)
+	}
+}
+
+func TestGlyphManagerEncodeFallsBack(t *testing.T) {
+	// None of these are in the character ROM, but all are in the bundled font.
+	const s = "ÀÂÃËÌÎÏÒÕ"
+	g := cfa635.NewGlyphManager()
+	got := g.Encode(s)
+	if len(got) != 9 {
+		t.Fatalf("Encode(%q) = %q, want 9 bytes", s, got)
+	}
+	seen := make(map[byte]bool)
+	for _, c := range got[:8] {
+		if c >= 8 || seen[c] {
+			t.Fatalf("Encode(%q) = %q, want eight different CGRAM characters first", s, got)
+		}
+		seen[c] = true
+	}
+	// With every slot taken, the ninth is transliterated.
+	if got[8] != 'O' {
+		t.Errorf("Encode(%q) ended with %q, want 'O'", s, got[8])
+	}
+	if _, ok := g.Sprite(ramp); ok {
+		t.Error("Sprite found a slot after Encode took all eight")
+	}
+}
+
+func TestGlyphManagerEvictionOrder(t *testing.T) {
+	var m cgram
+	g := cfa635.NewGlyphManager(0, 1)
+
+	// Frame 1 shows a but not b.
+	a := sprite(t, g, *ramp)
+	b := sprite(t, g, ramp.Invert())
+	if err := g.Commit(&m, [][]byte{{a, ' '}}); err != nil {
+		t.Fatal(err)
+	}
+	// Frame 2 requests b, so a is now the least recently requested, but a is
+	// still on the display.
+	sprite(t, g, ramp.Invert())
+	if err := g.Commit(&m, [][]byte{{a, ' '}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Frame 3 takes the unreferenced slot first, then the visible one.
+	if c := sprite(t, g, ramp.FlipHorizontal()); c != b {
+		t.Errorf("first new sprite got character %d, want unreferenced %d", c, b)
+	}
+	if c := sprite(t, g, ramp.FlipVertical()); c != a {
+		t.Errorf("second new sprite got character %d, want visible %d", c, a)
+	}
+	// Slots that this frame has requested are never reassigned.
+	if c, ok := g.Sprite(ramp); ok {
+		t.Errorf("third new sprite got character %d, want none", c)
+	}
+}
+
+func TestGlyphManagerCommitLoadsVisible(t *testing.T) {
+	var m cgram
+	g := cfa635.NewGlyphManager()
+	a := sprite(t, g, *ramp)
+	b := sprite(t, g, ramp.Invert())
+
+	if err := g.Commit(&m, [][]byte{{'x', a}, {a, 'y'}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.take(), []int{int(a)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first Commit loaded %v, want %v", got, want)
+	}
+	if m.data[a] != *ramp {
+		t.Errorf("slot %d holds\n%v\nwant\n%v", a, cfa635.Sprite(m.data[a]), ramp)
+	}
+
+	// Characters 8 to 15 show the same slots as 0 to 7.
+	sprite(t, g, *ramp)
+	sprite(t, g, ramp.Invert())
+	if err := g.Commit(&m, [][]byte{{a, b + 8}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.take(), []int{int(b)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second Commit loaded %v, want %v", got, want)
+	}
+
+	sprite(t, g, *ramp)
+	sprite(t, g, ramp.Invert())
+	if err := g.Commit(&m, [][]byte{{a, b}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.take(); len(got) != 0 {
+		t.Errorf("third Commit loaded %v, want nothing", got)
+	}
+}
+
+func TestGlyphManagerCommitRetries(t *testing.T) {
+	m := cgram{err: errors.New("link down")}
+	g := cfa635.NewGlyphManager()
+	a := sprite(t, g, *ramp)
+	if err := g.Commit(&m, [][]byte{{a}}); err != m.err {
+		t.Fatalf("Commit returned %v, want %v", err, m.err)
+	}
+
+	m.err = nil
+	sprite(t, g, *ramp)
+	if err := g.Commit(&m, [][]byte{{a}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.take(), []int{int(a)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Commit after failure loaded %v, want %v", got, want)
+	}
+}
+
+func TestGlyphManagerInvalidate(t *testing.T) {
+	var m cgram
+	g := cfa635.NewGlyphManager()
+	a := sprite(t, g, *ramp)
+	b := sprite(t, g, ramp.Invert())
+	if err := g.Commit(&m, [][]byte{{a, b}}); err != nil {
+		t.Fatal(err)
+	}
+	m.take()
+
+	g.Invalidate()
+	sprite(t, g, *ramp)
+	sprite(t, g, ramp.Invert())
+	if err := g.Commit(&m, [][]byte{{a, b}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.take(), []int{int(a), int(b)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Commit after Invalidate loaded %v, want %v", got, want)
+	}
+}
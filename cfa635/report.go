@@ -20,18 +20,26 @@ import (
 )
 
 var (
-	errUnknownReportType = errors.New("failed to read report: unknown type")
-	errUnknownKey        = errors.New("failed to read key activity report: unknown key")
-	errFBSCAB            = errors.New("failed to read fan speed report: FBSCAB module disconnected")
-	errDOW               = errors.New("failed to read temperature report: DOW sensor error")
+	errUnknownKey = errors.New("failed to read key activity report: unknown key")
+	errFBSCAB     = errors.New("failed to read fan speed report: FBSCAB module disconnected")
+	errDOW        = errors.New("failed to read temperature report: DOW sensor error")
 )
 
+// Report is a message initiated by the CFA635. It is a *KeyActivity,
+// *FanSpeed, *Temperature, or, for report types this package does not
+// understand, *RawReport.
+type Report interface {
+	isReport()
+}
+
 // KeyActivity is a report that a key has been pressed or released.
 type KeyActivity struct {
 	K       Key
 	Pressed bool
 }
 
+func (*KeyActivity) isReport() {}
+
 // Key represents a button on the CFA635.
 type Key int
 
@@ -45,6 +53,36 @@ const (
 	ExitButton
 )
 
+// allKeys lists every Key in the order of the bits in the CFA635's key masks.
+var allKeys = [...]Key{UpButton, EnterButton, ExitButton, LeftButton, RightButton, DownButton}
+
+// keyMask converts a list of keys to the CFA635's bitmask representation.
+func keyMask(ks []Key) (byte, error) {
+	var b byte
+Outer:
+	for _, k := range ks {
+		for i, l := range allKeys {
+			if k == l {
+				b |= 1 << i
+				continue Outer
+			}
+		}
+		return 0, ErrKey
+	}
+	return b, nil
+}
+
+// maskKeys converts a bitmask in the CFA635's representation to a list of keys.
+func maskKeys(b byte) []Key {
+	var ks []Key
+	for i, k := range allKeys {
+		if b&(1<<i) != 0 {
+			ks = append(ks, k)
+		}
+	}
+	return ks
+}
+
 // FanSpeed is a report on the speed of a system fan.
 type FanSpeed struct {
 	N          int
@@ -52,24 +90,37 @@ type FanSpeed struct {
 	TimerTicks int
 }
 
+func (*FanSpeed) isReport() {}
+
 // Temperature is a report on the system temperature.
 type Temperature struct {
 	N       int // Sensor number.
 	Celsius float64
 }
 
-// decodeReport converts a packet into either a *KeyActivity, a *FanSpeed, or a
-// *Temperature, depending on the packet's type tag.
-func decodeReport(p []byte) (any, error) {
-	switch p[0] {
-	case 0x80:
+func (*Temperature) isReport() {}
+
+// RawReport is a report of a type this package does not understand or with an
+// unexpected data length.
+type RawReport struct {
+	Type byte
+	Data []byte
+}
+
+func (*RawReport) isReport() {}
+
+// decodeReport converts a packet into a *KeyActivity, a *FanSpeed, a
+// *Temperature, or a *RawReport, depending on the packet's type tag.
+func decodeReport(p []byte) (Report, error) {
+	switch {
+	case p[0] == 0x80 && len(p) == 3:
 		return decodeKeyActivity(p[2])
-	case 0x81:
+	case p[0] == 0x81 && len(p) == 6:
 		return decodeFanSpeed(p[2:6])
-	case 0x82:
+	case p[0] == 0x82 && len(p) == 6:
 		return decodeTemperature(p[2:6])
 	default:
-		return nil, errUnknownReportType
+		return &RawReport{p[0], p[2:]}, nil
 	}
 }
 
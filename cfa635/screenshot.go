@@ -0,0 +1,137 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// Screenshot geometry, in LCD pixels
+const (
+	cellGap = 1 // Space between adjacent character cells
+	margin  = 3 // Space around the character cells
+)
+
+type screenshot struct {
+	pixel     color.RGBA
+	backlight color.RGBA
+	scale     int
+}
+
+// ScreenshotOption configures Screenshot and WritePNG.
+type ScreenshotOption func(*screenshot)
+
+// WithPixelColor sets the color of lit LCD pixels. The default is a dark
+// blue-green.
+func WithPixelColor(c color.Color) ScreenshotOption {
+	return func(s *screenshot) { s.pixel = color.RGBAModel.Convert(c).(color.RGBA) }
+}
+
+// WithBacklight sets the color of the backlight, which shows through unlit LCD
+// pixels. The default is yellow-green. To show a dimmed backlight, pass a
+// darker color.
+func WithBacklight(c color.Color) ScreenshotOption {
+	return func(s *screenshot) { s.backlight = color.RGBAModel.Convert(c).(color.RGBA) }
+}
+
+// WithScale sets the size of each LCD pixel in the image, in image pixels. The
+// default is 4.
+func WithScale(n int) ScreenshotOption {
+	return func(s *screenshot) {
+		if n > 0 {
+			s.scale = n
+		}
+	}
+}
+
+// Screenshot draws st.LCD as a CFA635 would show it, using the character ROM
+// for characters 0x10, …, 0xff and st.CGRAM for characters 0x00, …, 0x0f. (As
+// on the CFA635, characters 0x08, …, 0x0f repeat characters 0x00, …, 0x07.)
+// Screenshot ignores the rest of st; to show a dimmed backlight, use
+// WithBacklight.
+func Screenshot(st *State, opts ...ScreenshotOption) *image.RGBA {
+	s := screenshot{
+		pixel:     color.RGBA{0x10, 0x20, 0x10, 0xff},
+		backlight: color.RGBA{0x9a, 0xd4, 0x2a, 0xff},
+		scale:     4,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	// Unlit pixels are faintly visible against the backlight.
+	unlit := blend(s.backlight, s.pixel, 0.08)
+
+	lcd := &st.LCD
+	rows, cols := len(lcd), len(lcd[0])
+	w := 2*margin + cols*(SpriteWidth+cellGap) - cellGap
+	h := 2*margin + rows*(SpriteHeight+cellGap) - cellGap
+	img := image.NewRGBA(image.Rect(0, 0, w*s.scale, h*s.scale))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = s.backlight.R, s.backlight.G, s.backlight.B, s.backlight.A
+	}
+
+	for y, row := range lcd {
+		for x, c := range row {
+			var bitmap Sprite
+			if c < 0x10 {
+				bitmap = st.CGRAM[c&0x07]
+			} else {
+				bitmap = rom[c]
+			}
+
+			x0 := margin + x*(SpriteWidth+cellGap)
+			y0 := margin + y*(SpriteHeight+cellGap)
+			for py, bits := range bitmap {
+				for px := 0; px < SpriteWidth; px++ {
+					c := unlit
+					if bits&(1<<(SpriteWidth-1-px)) != 0 {
+						c = s.pixel
+					}
+					s.dot(img, x0+px, y0+py, c)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// WritePNG draws st as Screenshot does and writes the result to w as a PNG.
+func WritePNG(w io.Writer, st *State, opts ...ScreenshotOption) error {
+	return png.Encode(w, Screenshot(st, opts...))
+}
+
+// dot draws one LCD pixel. At scales above 2, it leaves a one-pixel gutter on
+// the right and bottom so the pixel grid is visible, as it is on the real LCD.
+func (s *screenshot) dot(img *image.RGBA, x, y int, c color.RGBA) {
+	size := s.scale
+	if size > 2 {
+		size--
+	}
+	for dy := 0; dy < size; dy++ {
+		for dx := 0; dx < size; dx++ {
+			img.SetRGBA(x*s.scale+dx, y*s.scale+dy, c)
+		}
+	}
+}
+
+// blend mixes a fraction f of color b into color a.
+func blend(a, b color.RGBA, f float64) color.RGBA {
+	mix := func(x, y uint8) uint8 { return uint8(float64(x)*(1-f) + float64(y)*f) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
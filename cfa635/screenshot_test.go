@@ -0,0 +1,103 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// golden compares got with the named file in testdata, or replaces the file
+// with got if -update is set.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file; rerun with -update and check the image", name)
+	}
+}
+
+// TestScreenshot draws every character, 80 to a screen. The first screen
+// begins with the 16 CGRAM characters, of which 3 and its repeat 11 hold a
+// sprite.
+func TestScreenshot(t *testing.T) {
+	st := cfa635.ClearedState()
+	st.CGRAM[3] = *cfa635.MustParseSprite(`
+		######
+		#....#
+		#.##.#
+		#.##.#
+		#....#
+		######
+		......
+		#.#.#.
+	`)
+	for page := 0; page < 4; page++ {
+		for i := range st.LCD {
+			for j := range st.LCD[i] {
+				c := page*80 + i*20 + j
+				if c > 0xff {
+					c = ' '
+				}
+				st.LCD[i][j] = byte(c)
+			}
+		}
+		var b bytes.Buffer
+		if err := cfa635.WritePNG(&b, st, cfa635.WithScale(2)); err != nil {
+			t.Fatal(err)
+		}
+		golden(t, fmt.Sprintf("screenshot-%d.png", page), b.Bytes())
+	}
+}
+
+func TestScreenshotSize(t *testing.T) {
+	img := cfa635.Screenshot(cfa635.ClearedState(), cfa635.WithScale(3))
+	// 20 columns and 4 rows of 6×8 cells, with 1-pixel gaps and a 3-pixel
+	// margin
+	const w, h = 2*3 + 20*7 - 1, 2*3 + 4*9 - 1
+	if got := img.Bounds().Size(); got.X != 3*w || got.Y != 3*h {
+		t.Errorf("size = %v, want %dx%d", got, 3*w, 3*h)
+	}
+	if _, err := png.Decode(bytes.NewReader(mustPNG(t, cfa635.ClearedState()))); err != nil {
+		t.Errorf("WritePNG wrote an unreadable PNG: %v", err)
+	}
+}
+
+func mustPNG(t *testing.T, st *cfa635.State) []byte {
+	var b bytes.Buffer
+	if err := cfa635.WritePNG(&b, st); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,333 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Sprite dimensions, in pixels
+const (
+	SpriteWidth  = 6
+	SpriteHeight = 8
+)
+
+// Sprite is a six-by-eight bitmap for a CGRAM slot, in the format SetCharacter
+// accepts: one byte per row, top to bottom, with the leftmost pixel in bit 5
+// and bits 6 and 7 clear.
+type Sprite [SpriteHeight]byte
+
+// ParseSprite reads a Sprite from text art: eight lines of six characters each,
+// where # or X is a lit pixel and . or a space is an unlit one. Blank lines
+// before and after the art are ignored, as is indentation shared by every
+// line, so art can be written in an indented raw string literal:
+//
+// 	cfa635.ParseSprite(`
+// 		......
+// 		.##.##
+// 		.##.##
+// 		.##.##
+// 		.##.##
+// 		.##.##
+// 		......
+// 		......
+// 	`)
+func ParseSprite(art string) (*Sprite, error) {
+	lines := strings.Split(strings.ReplaceAll(art, "\r\n", "\n"), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) != SpriteHeight {
+		return nil, fmt.Errorf("%w: %d rows, want %d", ErrSprite, len(lines), SpriteHeight)
+	}
+
+	// Tabs are never pixels, so any leading tabs are indentation.
+	indent := len(lines[0])
+	for _, l := range lines {
+		if n := len(l) - len(strings.TrimLeft(l, "\t")); n < indent {
+			indent = n
+		}
+	}
+
+	var s Sprite
+	for y, l := range lines {
+		l = strings.TrimRight(l[indent:], "\t")
+		if len(l) != SpriteWidth {
+			return nil, fmt.Errorf("%w: row %d has %d columns, want %d", ErrSprite, y, len(l), SpriteWidth)
+		}
+		for x, c := range []byte(l) {
+			switch c {
+			case '#', 'X':
+				s[y] |= 1 << (SpriteWidth - 1 - x)
+			case '.', ' ':
+			default:
+				return nil, fmt.Errorf("%w: unexpected %q at row %d, column %d", ErrSprite, c, y, x)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// MustParseSprite is like ParseSprite, but it panics if the art is malformed.
+// It simplifies initializing global variables holding sprites.
+func MustParseSprite(art string) *Sprite {
+	s, err := ParseSprite(art)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+var (
+	xbmDefine = regexp.MustCompile(`#define\s+\S*(width|height)\s+(\d+)`)
+	xbmBits   = regexp.MustCompile(`(?s)\{(.*)\}`)
+)
+
+// ParseXBM reads a Sprite from an X bitmap file, as written by bitmap(1), GIMP,
+// and other image editors. The bitmap must be six pixels wide and eight pixels
+// high.
+func ParseXBM(data []byte) (*Sprite, error) {
+	var w, h int
+	for _, m := range xbmDefine.FindAllSubmatch(data, -1) {
+		n, err := strconv.Atoi(string(m[2]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: XBM %s: %v", ErrSprite, m[1], err)
+		}
+		if string(m[1]) == "width" {
+			w = n
+		} else {
+			h = n
+		}
+	}
+	if w != SpriteWidth || h != SpriteHeight {
+		return nil, fmt.Errorf("%w: XBM is %dx%d, want %dx%d", ErrSprite, w, h, SpriteWidth, SpriteHeight)
+	}
+
+	m := xbmBits.FindSubmatch(data)
+	if m == nil {
+		return nil, fmt.Errorf("%w: XBM has no bits", ErrSprite)
+	}
+	var rows []byte
+	for _, f := range bytes.Split(m[1], []byte(",")) {
+		f = bytes.TrimSpace(f)
+		if len(f) == 0 {
+			continue
+		}
+		b, err := strconv.ParseUint(string(f), 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("%w: XBM: %v", ErrSprite, err)
+		}
+		rows = append(rows, byte(b))
+	}
+	if len(rows) != SpriteHeight {
+		return nil, fmt.Errorf("%w: XBM has %d bytes, want %d", ErrSprite, len(rows), SpriteHeight)
+	}
+
+	// XBM stores the leftmost pixel in the least significant bit.
+	var s Sprite
+	for y, b := range rows {
+		for x := 0; x < SpriteWidth; x++ {
+			if b&(1<<x) != 0 {
+				s[y] |= 1 << (SpriteWidth - 1 - x)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// ParsePBM reads a Sprite from a portable bitmap file in either the plain (P1)
+// or raw (P4) format. The bitmap must be six pixels wide and eight pixels high.
+// Black pixels are lit.
+func ParsePBM(data []byte) (*Sprite, error) {
+	r := pbmReader{data: data}
+	magic := r.token()
+	if magic != "P1" && magic != "P4" {
+		return nil, fmt.Errorf("%w: not a PBM file", ErrSprite)
+	}
+	w, err1 := strconv.Atoi(r.token())
+	h, err2 := strconv.Atoi(r.token())
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("%w: malformed PBM header", ErrSprite)
+	}
+	if w != SpriteWidth || h != SpriteHeight {
+		return nil, fmt.Errorf("%w: PBM is %dx%d, want %dx%d", ErrSprite, w, h, SpriteWidth, SpriteHeight)
+	}
+
+	var s Sprite
+	if magic == "P4" {
+		// A single whitespace character separates the header from the
+		// raster, in which each row is one byte, most significant bit
+		// first.
+		if r.pos+1+SpriteHeight > len(r.data) {
+			return nil, fmt.Errorf("%w: PBM raster is truncated", ErrSprite)
+		}
+		raster := r.data[r.pos+1:]
+		for y := range s {
+			s[y] = raster[y] >> (8 - SpriteWidth)
+		}
+		return &s, nil
+	}
+
+	for y := range s {
+		for x := 0; x < SpriteWidth; x++ {
+			switch r.bit() {
+			case '1':
+				s[y] |= 1 << (SpriteWidth - 1 - x)
+			case '0':
+			default:
+				return nil, fmt.Errorf("%w: PBM raster is malformed", ErrSprite)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// pbmReader splits a PBM file into tokens, skipping whitespace and comments.
+type pbmReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *pbmReader) skip() {
+	for r.pos < len(r.data) {
+		switch c := r.data[r.pos]; {
+		case c == '#':
+			for r.pos < len(r.data) && r.data[r.pos] != '\n' {
+				r.pos++
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\v' || c == '\f':
+			r.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (r *pbmReader) token() string {
+	r.skip()
+	start := r.pos
+	for r.pos < len(r.data) && !bytes.ContainsRune([]byte(" \t\r\n\v\f#"), rune(r.data[r.pos])) {
+		r.pos++
+	}
+	return string(r.data[start:r.pos])
+}
+
+// bit reads a single pixel from a plain PBM raster, in which pixels need not be
+// separated by whitespace.
+func (r *pbmReader) bit() byte {
+	r.skip()
+	if r.pos >= len(r.data) {
+		return 0
+	}
+	r.pos++
+	return r.data[r.pos-1]
+}
+
+// Validate returns ErrSprite if any row of s has bits set outside the six-pixel
+// cell.
+func (s Sprite) Validate() error {
+	for y, b := range s {
+		if b&0b11_000000 != 0 {
+			return fmt.Errorf("%w: row %d is wider than %d pixels", ErrSprite, y, SpriteWidth)
+		}
+	}
+	return nil
+}
+
+// FlipHorizontal returns s mirrored left to right.
+func (s Sprite) FlipHorizontal() Sprite {
+	var r Sprite
+	for y, b := range s {
+		for x := 0; x < SpriteWidth; x++ {
+			if b&(1<<x) != 0 {
+				r[y] |= 1 << (SpriteWidth - 1 - x)
+			}
+		}
+	}
+	return r
+}
+
+// FlipVertical returns s mirrored top to bottom.
+func (s Sprite) FlipVertical() Sprite {
+	var r Sprite
+	for y, b := range s {
+		r[SpriteHeight-1-y] = b
+	}
+	return r
+}
+
+// Invert returns s with every pixel toggled.
+func (s Sprite) Invert() Sprite {
+	for y := range s {
+		s[y] ^= 0b00_111111
+	}
+	return s
+}
+
+// Shift returns s moved dx pixels right and dy pixels down. Negative values
+// move it left and up. Pixels shifted out of the cell are lost, and the pixels
+// shifted in are unlit.
+func (s Sprite) Shift(dx, dy int) Sprite {
+	var r Sprite
+	for y := range r {
+		sy := y - dy
+		if sy < 0 || sy >= SpriteHeight {
+			continue
+		}
+		switch {
+		case dx >= SpriteWidth || dx <= -SpriteWidth:
+		case dx >= 0:
+			r[y] = s[sy] >> dx
+		default:
+			r[y] = (s[sy] << -dx) & 0b00_111111
+		}
+	}
+	return r
+}
+
+// String returns s as text art in the format ParseSprite accepts.
+func (s Sprite) String() string {
+	var b strings.Builder
+	for _, row := range s {
+		for x := 0; x < SpriteWidth; x++ {
+			if row&(1<<(SpriteWidth-1-x)) != 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// SetSprite is like SetCharacter, but it takes a Sprite.
+func (m *Module) SetSprite(i int, s *Sprite) error {
+	return m.SetSpriteContext(context.Background(), i, s)
+}
+
+// SetSpriteContext is like SetSprite, but it gives up with ctx.Err() if ctx is
+// done before the CFA635 responds.
+func (m *Module) SetSpriteContext(ctx context.Context, i int, s *Sprite) error {
+	return m.SetCharacterContext(ctx, i, (*[8]byte)(s))
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+// ramp is the sprite in testdata/ramp.*. It's asymmetric left to right and top
+// to bottom, so it catches flipped bit orders.
+var ramp = cfa635.MustParseSprite(`
+	#.....
+	##....
+	###...
+	####..
+	#####.
+	######
+	.#.#.#
+	......
+`)
+
+func TestParseSprite(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		art  string
+		want *cfa635.Sprite // Nil for ErrSprite
+	}{
+		{"indented", "\n\t\t#.....\n\t\t##....\n\t\t###...\n\t\t####..\n\t\t#####.\n\t\t######\n\t\t.#.#.#\n\t\t......\n\t", ramp},
+		// A blank last row of spaces would be trimmed, so it uses dots.
+		{"X and space", "X     \nXX    \nXXX   \nXXXX  \nXXXXX \nXXXXXX\n X X X\n......", ramp},
+		{"CRLF", "#.....\r\n##....\r\n###...\r\n####..\r\n#####.\r\n######\r\n.#.#.#\r\n......", ramp},
+		{"too few rows", "#.....\n##....", nil},
+		{"too wide", "#......\n##....\n###...\n####..\n#####.\n######\n.#.#.#\n......", nil},
+		{"bad pixel", "#....o\n##....\n###...\n####..\n#####.\n######\n.#.#.#\n......", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			check(t, tc.want)(cfa635.ParseSprite(tc.art))
+		})
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	for _, tc := range []struct {
+		file  string
+		parse func([]byte) (*cfa635.Sprite, error)
+		want  *cfa635.Sprite // Nil for ErrSprite
+	}{
+		{"ramp.xbm", cfa635.ParseXBM, ramp},
+		{"wide.xbm", cfa635.ParseXBM, nil},
+		{"short.xbm", cfa635.ParseXBM, nil},
+		{"ramp-plain.pbm", cfa635.ParsePBM, ramp},
+		{"ramp-raw.pbm", cfa635.ParsePBM, ramp},
+		{"wide.pbm", cfa635.ParsePBM, nil},
+		{"truncated.pbm", cfa635.ParsePBM, nil},
+		{"ramp.xbm", cfa635.ParsePBM, nil},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tc.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			check(t, tc.want)(tc.parse(data))
+		})
+	}
+}
+
+// check returns a function that checks a parser's results against want, or
+// against ErrSprite if want is nil.
+func check(t *testing.T, want *cfa635.Sprite) func(*cfa635.Sprite, error) {
+	return func(got *cfa635.Sprite, err error) {
+		t.Helper()
+		switch {
+		case want == nil && !errors.Is(err, cfa635.ErrSprite):
+			t.Errorf("got %v, %v; want ErrSprite", got, err)
+		case want != nil && err != nil:
+			t.Errorf("got error %v, want\n%v", err, want)
+		case want != nil && *got != *want:
+			t.Errorf("got\n%v\nwant\n%v", got, want)
+		}
+	}
+}
+
+func TestSpriteTransforms(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		got  cfa635.Sprite
+		want string
+	}{
+		{"FlipHorizontal", ramp.FlipHorizontal(), `
+			.....#
+			....##
+			...###
+			..####
+			.#####
+			######
+			#.#.#.
+			......
+		`},
+		{"FlipVertical", ramp.FlipVertical(), `
+			......
+			.#.#.#
+			######
+			#####.
+			####..
+			###...
+			##....
+			#.....
+		`},
+		{"Invert", ramp.Invert(), `
+			.#####
+			..####
+			...###
+			....##
+			.....#
+			......
+			#.#.#.
+			######
+		`},
+		{"Shift right and down", ramp.Shift(2, 1), `
+			......
+			..#...
+			..##..
+			..###.
+			..####
+			..####
+			..####
+			...#.#
+		`},
+		{"Shift left and up", ramp.Shift(-1, -2), `
+			##....
+			###...
+			####..
+			#####.
+			#.#.#.
+			......
+			......
+			......
+		`},
+		{"Shift out", ramp.Shift(6, 0), `
+			......
+			......
+			......
+			......
+			......
+			......
+			......
+			......
+		`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if want := cfa635.MustParseSprite(tc.want); tc.got != *want {
+				t.Errorf("got\n%v\nwant\n%v", tc.got, want)
+			}
+		})
+	}
+
+	if got := ramp.FlipHorizontal().FlipHorizontal(); got != *ramp {
+		t.Errorf("flipping twice gave\n%v", got)
+	}
+}
+
+func TestSpriteValidate(t *testing.T) {
+	if err := ramp.Validate(); err != nil {
+		t.Errorf("ramp: %v", err)
+	}
+	for _, bit := range []byte{0x40, 0x80} {
+		s := *ramp
+		s[4] |= bit
+		if err := s.Validate(); !errors.Is(err, cfa635.ErrSprite) {
+			t.Errorf("with bit %#x set: got %v, want ErrSprite", bit, err)
+		}
+	}
+	for _, s := range []cfa635.Sprite{ramp.Invert(), ramp.Shift(-3, 0), ramp.FlipHorizontal()} {
+		if err := s.Validate(); err != nil {
+			t.Errorf("transformed sprite\n%v: %v", s, err)
+		}
+	}
+}
@@ -14,9 +14,54 @@
 
 package cfa635
 
-// State represents the state of the CFA635 LCD.
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// State is everything the host controls about what a CFA635 shows.
+type State struct {
+	LCD   LCDState
+	CGRAM [8]Sprite // Special character bitmaps
+
+	// Brightness of the LCD and keypad backlights, from 0 to 100, inclusive
+	Backlight, KeypadBacklight int
+
+	// Red and green duty cycles of the four LEDs, from top to bottom
+	LEDs [4][2]int
+
+	Contrast    int
+	CursorCol   int
+	CursorRow   int
+	CursorStyle CursorStyle
+}
+
+// ClearedState returns a State with a blank LCD. Everything else is zero: the
+// special characters are blank, the backlights and LEDs are off, and there is
+// no cursor.
+func ClearedState() *State {
+	return &State{LCD: *ClearedLCDState()}
+}
+
+// LCDState represents the contents of the CFA635 LCD.
 type LCDState [4][20]byte
 
+// String returns the LCD contents as four lines of text, converted to Unicode as
+// by NewDecoder.
+func (s LCDState) String() string {
+	var b strings.Builder
+	for y, row := range s {
+		if y > 0 {
+			b.WriteByte('\n')
+		}
+		for _, c := range row {
+			b.WriteRune(decodeTable[c])
+		}
+	}
+	return b.String()
+}
+
 func ClearedLCDState() *LCDState {
 	var r LCDState
 	for y := range r {
@@ -27,26 +72,135 @@ func ClearedLCDState() *LCDState {
 	return &r
 }
 
-func Update(m *Module, old, new *LCDState) error {
-	if *old == *new {
+// Update sends m the commands that change it from old to new, skipping the
+// settings that are already right. If old is nil, Update clears the LCD and
+// then sends every setting in new.
+//
+// Update loads changed special characters before writing the LCD, and it
+// rewrites every cell that shows a changed special character, even if the
+// cell itself is unchanged, so the LCD never shows a stale bitmap.
+func Update(m *Module, old, new *State) error {
+	return UpdateContext(context.Background(), m, old, new)
+}
+
+// UpdateContext is like Update, but it gives up with ctx.Err() if ctx is done
+// before the CFA635 responds to a command.
+func UpdateContext(ctx context.Context, m *Module, old, new *State) error {
+	all := old == nil
+	if all {
+		if err := m.ClearContext(ctx); err != nil {
+			return err
+		}
+		old = ClearedState()
+	} else if *old == *new {
 		return nil
 	}
 
-	for y := range old {
-		var first, last int
+	var changed uint8 // Bit i is set if special character i changed
+	for i := range new.CGRAM {
+		if all || new.CGRAM[i] != old.CGRAM[i] {
+			if err := m.SetSpriteContext(ctx, i, &new.CGRAM[i]); err != nil {
+				return err
+			}
+			changed |= 1 << i
+		}
+	}
+	if err := updateLCD(ctx, m, &old.LCD, &new.LCD, changed); err != nil {
+		return err
+	}
 
-		for ; first < len(old[y]) && new[y][first] == old[y][first]; first++ {
+	if all || new.Contrast != old.Contrast {
+		if err := m.SetContrastContext(ctx, new.Contrast); err != nil {
+			return err
 		}
-		if first == len(old[y]) {
-			continue
+	}
+	if all || new.Backlight != old.Backlight || new.KeypadBacklight != old.KeypadBacklight {
+		if err := m.SetBacklightContext(ctx, new.Backlight, new.KeypadBacklight); err != nil {
+			return err
 		}
-
-		for last = len(old[y]) - 1; last > first && new[y][last] == old[y][last]; last-- {
+	}
+	for led := range new.LEDs {
+		for i, duty := range new.LEDs[led] {
+			if all || duty != old.LEDs[led][i] {
+				if err := m.SetLEDContext(ctx, led, i == 1, duty); err != nil {
+					return err
+				}
+			}
 		}
-		if err := m.Put(first, y, new[y][first:last+1]); err != nil {
+	}
+	if all || new.CursorCol != old.CursorCol || new.CursorRow != old.CursorRow {
+		if err := m.SetCursorPositionContext(ctx, new.CursorCol, new.CursorRow); err != nil {
 			return err
 		}
 	}
+	if all || new.CursorStyle != old.CursorStyle {
+		if err := m.SetCursorStyleContext(ctx, new.CursorStyle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	// putFraming is the number of bytes a Put sends and receives beyond
+	// its data: the request's type, length, position, and CRC, and the
+	// response's type, length, and CRC.
+	putFraming = 6 + 4
+
+	// usbRoundTrip is the least time a command takes beyond its bytes on
+	// the wire. The CFA635 sits behind a USB serial bridge, which can
+	// deliver a response no sooner than the next 1 ms USB frame, and a
+	// Put blocks until its response arrives.
+	usbRoundTrip = time.Millisecond
+)
+
+// putOverhead returns the cost of a Put beyond its data, in byte times on m's
+// link: about 22 at 115200 baud, where the USB round trip dominates, and 12 at
+// 19200 baud. Bytes are 10 bits long with 8N1 framing.
+func (m *Module) putOverhead() int {
+	byteTime := 10 * time.Second / time.Duration(m.baud)
+	return putFraming + int((usbRoundTrip+byteTime-1)/byteTime)
+}
+
+// updateLCD writes the cells that differ between old and new, along with the
+// cells that show the special characters in cgram, a bit mask.
+//
+// Within a row, it has to choose which changed cells to write with one Put.
+// Writing two runs of changed cells together costs the unchanged cells between
+// them; writing them separately costs another Put's overhead. Each gap's cost
+// is independent of the others, so merging every gap shorter than the overhead
+// is optimal. At 115200 baud, no gap in a 20-column row outweighs a round trip,
+// so each changed row takes one Put; slower links split rows with long gaps.
+func updateLCD(ctx context.Context, m *Module, old, new *LCDState, cgram uint8) error {
+	overhead := m.putOverhead()
+	for y := range new {
+		dirty := func(x int) bool {
+			c := new[y][x]
+			return c != old[y][x] || c < 0x10 && cgram&(1<<(c&0x07)) != 0
+		}
+
+		start, end := -1, 0 // Cells in the pending Put, if start >= 0
+		for x := range new[y] {
+			if !dirty(x) {
+				continue
+			}
+			if start >= 0 && x-end > overhead {
+				if err := m.PutContext(ctx, start, y, new[y][start:end]); err != nil {
+					return err
+				}
+				start = -1
+			}
+			if start < 0 {
+				start = x
+			}
+			end = x + 1
+		}
+		if start >= 0 {
+			if err := m.PutContext(ctx, start, y, new[y][start:end]); err != nil {
+				return err
+			}
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,265 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/cfa635/cfa635test"
+)
+
+// linkMeter stands in for the serial link to an emulated CFA635 and counts the
+// bytes and Puts the host sends. If byteTime is nonzero, each command also takes
+// as long as it would on a real link: byteTime for every byte of a Put and its
+// response, plus a USB round trip.
+type linkMeter struct {
+	*cfa635test.Emulator
+	byteTime time.Duration
+	sent     int
+	puts     int
+}
+
+func (l *linkMeter) Write(p []byte) (int, error) {
+	l.sent += len(p)
+	if len(p) > 0 && p[0] == 0x1f {
+		l.puts++
+	}
+	if l.byteTime > 0 {
+		const response = 4 // Type, length, and CRC
+		time.Sleep(time.Duration(len(p)+response)*l.byteTime + time.Millisecond)
+	}
+	return l.Emulator.Write(p)
+}
+
+func connectMeter(t testing.TB, opts ...cfa635.Option) (*cfa635.Module, *linkMeter) {
+	l := &linkMeter{Emulator: cfa635test.NewEmulator()}
+	m := cfa635.Connect(l, opts...)
+	t.Cleanup(func() { m.Close() })
+	return m, l
+}
+
+// sparse returns a state with changes at both ends of row 0 and a short gap in
+// row 1.
+func sparse() (old, new *cfa635.State) {
+	old = cfa635.ClearedState()
+	s := *old
+	s.LCD[0][0] = 'a'
+	s.LCD[0][19] = 'b'
+	s.LCD[1][3] = 'c'
+	s.LCD[1][9] = 'd'
+	return old, &s
+}
+
+func TestUpdateMergesRowsAtFullSpeed(t *testing.T) {
+	m, l := connectMeter(t)
+	old, new := sparse()
+	if err := cfa635.Update(m, old, new); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.LCD(); got != new.LCD {
+		t.Errorf("LCD =\n%v\nwant\n%v", got, new.LCD)
+	}
+	// One Put per row: 6 bytes of framing plus 20 cells in row 0 and 7 in
+	// row 1.
+	if l.puts != 2 || l.sent != 6+20+6+7 {
+		t.Errorf("sent %d bytes in %d Puts, want 39 bytes in 2 Puts", l.sent, l.puts)
+	}
+}
+
+func TestUpdateSplitsLongGapsOnSlowLinks(t *testing.T) {
+	m, l := connectMeter(t, cfa635.WithBaudRate(19200))
+	old, new := sparse()
+	if err := cfa635.Update(m, old, new); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.LCD(); got != new.LCD {
+		t.Errorf("LCD =\n%v\nwant\n%v", got, new.LCD)
+	}
+	// Row 0's 18-cell gap costs more than a second Put; row 1's 5-cell gap
+	// doesn't.
+	if l.puts != 3 || l.sent != 6+1+6+1+6+7 {
+		t.Errorf("sent %d bytes in %d Puts, want 27 bytes in 3 Puts", l.sent, l.puts)
+	}
+}
+
+func TestUpdateScrollingText(t *testing.T) {
+	m, l := connectMeter(t)
+	const text = "Scrolling text that doesn't fit on one row"
+	old := cfa635.ClearedState()
+	for i := 0; i+20 <= len(text); i++ {
+		new := *old
+		copy(new.LCD[1][:], text[i:i+20])
+		l.sent, l.puts = 0, 0
+		if err := cfa635.Update(m, old, &new); err != nil {
+			t.Fatal(err)
+		}
+		if got := l.LCD(); got != new.LCD {
+			t.Fatalf("step %d: LCD =\n%v\nwant\n%v", i, got, new.LCD)
+		}
+		if l.puts != 1 || l.sent > 6+20 {
+			t.Errorf("step %d: sent %d bytes in %d Puts, want at most 26 bytes in 1 Put", i, l.sent, l.puts)
+		}
+		old = &new
+	}
+}
+
+func TestUpdateRewritesChangedSpecialCharacters(t *testing.T) {
+	m, l := connectMeter(t)
+	old := cfa635.ClearedState()
+	old.LCD[2][5] = 3
+	if err := cfa635.Update(m, nil, old); err != nil {
+		t.Fatal(err)
+	}
+
+	new := *old
+	new.CGRAM[3] = cfa635.Sprite{1, 2, 3, 4, 5, 6, 7, 8}
+	l.sent, l.puts = 0, 0
+	if err := cfa635.Update(m, old, &new); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfa635.Sprite(l.Character(3)); got != new.CGRAM[3] {
+		t.Errorf("sprite 3 = %v, want %v", got, new.CGRAM[3])
+	}
+	if l.puts != 1 {
+		t.Errorf("sent %d Puts, want 1 to rewrite the cell showing sprite 3", l.puts)
+	}
+}
+
+// workloads are sequences of LCD states that audiotrond commonly produces.
+var workloads = []struct {
+	name  string
+	frame func(i int, s *cfa635.State)
+}{
+	// The MPD screen's time elapsed and remaining, which change at both
+	// ends of the last row every second
+	{"times", func(i int, s *cfa635.State) {
+		copy(s.LCD[3][:], fmt.Sprintf("%d:%02d          -%d:%02d", i/60%10, i%60, (599-i%600)/60, (599-i%600)%60))
+	}},
+
+	// A track title rotating through the first row
+	{"scrolling", func(i int, s *cfa635.State) {
+		const text = "A track title much too long for the display       "
+		for x := range s.LCD[0] {
+			s.LCD[0][x] = text[(i+x)%len(text)]
+		}
+	}},
+}
+
+// TestUpdateMatchesSpansAtFullSpeed checks that at 115200 baud, where no gap
+// in a row outweighs another Put, Update sends exactly what putSpans does.
+func TestUpdateMatchesSpansAtFullSpeed(t *testing.T) {
+	for _, w := range workloads {
+		m1, l1 := connectMeter(t)
+		m2, l2 := connectMeter(t)
+		old := cfa635.ClearedState()
+		for i := 0; i < 100; i++ {
+			new := *old
+			w.frame(i, &new)
+			if err := cfa635.Update(m1, old, &new); err != nil {
+				t.Fatal(err)
+			}
+			if err := putSpans(m2, old, &new); err != nil {
+				t.Fatal(err)
+			}
+			old = &new
+		}
+		if l1.sent != l2.sent || l1.puts != l2.puts {
+			t.Errorf("%s: Update sent %d bytes in %d Puts; putSpans sent %d bytes in %d Puts", w.name, l1.sent, l1.puts, l2.sent, l2.puts)
+		}
+	}
+}
+
+// BenchmarkUpdate compares Update with three alternatives: Update with the
+// cost model for a 19200-baud link, which splits rows with long gaps between
+// changes; writing each changed row from its first changed cell to its last,
+// as Update did before it had a cost model; and writing every changed row in
+// full. It reports the bytes and Puts each frame sends. The link takes as long
+// as a real one, so ns/op estimates the time each frame takes to draw.
+func BenchmarkUpdate(b *testing.B) {
+	strategies := []struct {
+		name   string
+		model  int // Baud rate for Update's cost model, or 0 for the link's
+		update func(m *cfa635.Module, old, new *cfa635.State) error
+	}{
+		{"Update", 0, cfa635.Update},
+		{"split", 19200, cfa635.Update},
+		{"spans", 0, putSpans},
+		{"rows", 0, putChangedRows},
+	}
+	for _, w := range workloads {
+		for _, baud := range []int{115200, 19200} {
+			for _, s := range strategies {
+				if s.model == baud {
+					continue // Same as Update
+				}
+				model := s.model
+				if model == 0 {
+					model = baud
+				}
+				b.Run(fmt.Sprintf("%s/%d/%s", w.name, baud, s.name), func(b *testing.B) {
+					m, l := connectMeter(b, cfa635.WithBaudRate(model))
+					l.byteTime = 10 * time.Second / time.Duration(baud)
+					old := cfa635.ClearedState()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						new := *old
+						w.frame(i, &new)
+						if err := s.update(m, old, &new); err != nil {
+							b.Fatal(err)
+						}
+						old = &new
+					}
+					b.ReportMetric(float64(l.sent)/float64(b.N), "bytes/op")
+					b.ReportMetric(float64(l.puts)/float64(b.N), "puts/op")
+				})
+			}
+		}
+	}
+}
+
+func putChangedRows(m *cfa635.Module, old, new *cfa635.State) error {
+	for y := range new.LCD {
+		if new.LCD[y] != old.LCD[y] {
+			if err := m.Put(0, y, new.LCD[y][:]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// putSpans writes each changed row from its first changed cell to its last.
+func putSpans(m *cfa635.Module, old, new *cfa635.State) error {
+	for y := range new.LCD {
+		start, end := -1, 0
+		for x := range new.LCD[y] {
+			if new.LCD[y][x] != old.LCD[y][x] {
+				if start < 0 {
+					start = x
+				}
+				end = x + 1
+			}
+		}
+		if start >= 0 {
+			if err := m.Put(start, y, new.LCD[y][start:end]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
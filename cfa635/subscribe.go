@@ -0,0 +1,106 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// reportBuffer is the number of reports ReadReport buffers.
+const reportBuffer = 16
+
+// Subscription is a stream of reports from the CFA635.
+type Subscription struct {
+	dropped uint64 // First, so atomic operations on it are 64-bit aligned
+
+	// C delivers reports. It is closed when the subscription ends, either
+	// because of a call to Unsubscribe or because the Module has closed.
+	C <-chan Report
+
+	c    chan Report
+	subs *subscriptions
+}
+
+// Subscribe starts delivering reports from the CFA635 to a new channel with
+// the given buffer size. Every subscription receives every report. If a
+// subscriber falls far enough behind that its buffer fills, the Module drops
+// reports for that subscriber rather than waiting for it.
+func (m *Module) Subscribe(buffer int) *Subscription {
+	c := make(chan Report, buffer)
+	s := &Subscription{C: c, c: c, subs: &m.subs}
+	m.subs.add(s)
+	return s
+}
+
+// Unsubscribe ends the subscription and closes s.C.
+func (s *Subscription) Unsubscribe() { s.subs.remove(s) }
+
+// Dropped returns the number of reports dropped because s.C was full.
+func (s *Subscription) Dropped() uint64 { return atomic.LoadUint64(&s.dropped) }
+
+// subscriptions is the set of subscriptions to a Module's reports.
+type subscriptions struct {
+	mu     sync.Mutex
+	set    map[*Subscription]struct{}
+	closed bool
+}
+
+func newSubscriptions() subscriptions {
+	return subscriptions{set: make(map[*Subscription]struct{})}
+}
+
+func (ss *subscriptions) add(s *Subscription) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.closed {
+		close(s.c)
+		return
+	}
+	ss.set[s] = struct{}{}
+}
+
+func (ss *subscriptions) remove(s *Subscription) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if _, ok := ss.set[s]; ok {
+		delete(ss.set, s)
+		close(s.c)
+	}
+}
+
+// publish delivers a report to every subscription without blocking.
+func (ss *subscriptions) publish(r Report) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for s := range ss.set {
+		select {
+		case s.c <- r:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// close ends every subscription, present and future.
+func (ss *subscriptions) close() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.closed = true
+	for s := range ss.set {
+		close(s.c)
+	}
+	ss.set = nil
+}
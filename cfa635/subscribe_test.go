@@ -0,0 +1,130 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/cfa635/cfa635test"
+)
+
+func connect(t *testing.T) (*cfa635.Module, *cfa635test.Emulator) {
+	e := cfa635test.NewEmulator()
+	m := cfa635.Connect(e)
+	t.Cleanup(func() { m.Close() })
+	return m, e
+}
+
+// next waits for the next report on s and checks that it's want.
+func next(t *testing.T, s *cfa635.Subscription, want cfa635.Report) {
+	t.Helper()
+	select {
+	case got, ok := <-s.C:
+		if !ok {
+			t.Fatalf("subscription closed, want %#v", want)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %#v, want %#v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("got nothing, want %#v", want)
+	}
+}
+
+// closed checks that s.C closes without delivering anything more.
+func closed(t *testing.T, s *cfa635.Subscription) {
+	t.Helper()
+	select {
+	case r, ok := <-s.C:
+		if ok {
+			t.Errorf("got %#v, want the subscription closed", r)
+		}
+	case <-time.After(time.Second):
+		t.Error("subscription still open")
+	}
+}
+
+func TestSubscribeFansOut(t *testing.T) {
+	m, e := connect(t)
+	subs := []*cfa635.Subscription{m.Subscribe(4), m.Subscribe(4), m.Subscribe(4)}
+
+	e.PressKey(cfa635.UpButton)
+	e.ReleaseKey(cfa635.UpButton)
+	e.ReportTemperature(2, 21.5)
+	for _, s := range subs {
+		next(t, s, &cfa635.KeyActivity{K: cfa635.UpButton, Pressed: true})
+		next(t, s, &cfa635.KeyActivity{K: cfa635.UpButton, Pressed: false})
+		next(t, s, &cfa635.Temperature{N: 2, Celsius: 21.5})
+	}
+}
+
+func TestSubscribeCountsDropped(t *testing.T) {
+	m, e := connect(t)
+	slow := m.Subscribe(1)
+	fast := m.Subscribe(8)
+
+	for i := 0; i < 4; i++ {
+		e.PressKey(cfa635.DownButton)
+	}
+	for i := 0; i < 4; i++ {
+		next(t, fast, &cfa635.KeyActivity{K: cfa635.DownButton, Pressed: true})
+	}
+	// The Module may still be publishing the last report to slow.
+	for deadline := time.Now().Add(time.Second); slow.Dropped() != 3; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("slow subscriber dropped %d reports, want 3", slow.Dropped())
+		}
+	}
+	if n := fast.Dropped(); n != 0 {
+		t.Errorf("fast subscriber dropped %d reports, want 0", n)
+	}
+	next(t, slow, &cfa635.KeyActivity{K: cfa635.DownButton, Pressed: true})
+}
+
+func TestUnsubscribe(t *testing.T) {
+	m, e := connect(t)
+	gone := m.Subscribe(4)
+	stays := m.Subscribe(4)
+
+	gone.Unsubscribe()
+	closed(t, gone)
+	gone.Unsubscribe() // Unsubscribing twice is harmless.
+
+	e.PressKey(cfa635.LeftButton)
+	next(t, stays, &cfa635.KeyActivity{K: cfa635.LeftButton, Pressed: true})
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	m, _ := connect(t)
+	s := m.Subscribe(4)
+	m.Close()
+	closed(t, s)
+	closed(t, m.Subscribe(4))
+}
+
+func TestSubscribeRawReport(t *testing.T) {
+	m, e := connect(t)
+	s := m.Subscribe(4)
+
+	e.Report(0x9f, []byte{1, 2, 3})
+	next(t, s, &cfa635.RawReport{Type: 0x9f, Data: []byte{1, 2, 3}})
+
+	// A known type with the wrong length is raw, too.
+	e.Report(0x80, []byte{1, 2})
+	next(t, s, &cfa635.RawReport{Type: 0x80, Data: []byte{1, 2}})
+}
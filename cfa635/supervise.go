@@ -0,0 +1,183 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+)
+
+const (
+	minReconnectBackoff = 100 * time.Millisecond
+	maxReconnectBackoff = 5 * time.Second
+)
+
+// Dial constructs a supervised Module. It calls dial to open a connection to
+// the CFA635 and calls it again whenever that connection fails (for instance,
+// because a USB serial adapter was unplugged and plugged back in). After
+// reconnecting, the Module restores the special characters, LCD contents,
+// backlight, and LED and GPIO settings most recently requested through it.
+//
+// While the Module is reconnecting, commands fail with ErrDisconnected.
+func Dial(dial func() (io.ReadWriteCloser, error), opts ...Option) (*Module, error) {
+	rwc, err := dial()
+	if err != nil {
+		return nil, err
+	}
+
+	m := newModule(opts)
+	m.dial = dial
+	m.mu.Lock()
+	m.link = m.attach(rwc)
+	m.mu.Unlock()
+	return m, nil
+}
+
+// reconnect dials the CFA635 until it succeeds or the Module closes.
+func (m *Module) reconnect() {
+	for {
+		m.mu.Lock()
+		closed := m.closed
+		backoff := m.backoff
+		m.backoff *= 2
+		if m.backoff > maxReconnectBackoff {
+			m.backoff = maxReconnectBackoff
+		}
+		m.mu.Unlock()
+		if closed {
+			m.subs.close()
+			return
+		}
+
+		time.Sleep(backoff)
+
+		rwc, err := m.dial()
+		if err != nil {
+			log.Print("failed to reconnect to CFA635: ", err)
+			continue
+		}
+		// If resuming fails, the new link dies, and detaching it starts
+		// another reconnection attempt.
+		if err := m.resume(rwc); err != nil {
+			log.Print("failed to restore CFA635 state: ", err)
+		}
+		return
+	}
+}
+
+// resume attaches a new connection and replays the shadow state to it, holding
+// off other commands until it has finished.
+func (m *Module) resume(rwc io.ReadWriteCloser) error {
+	m.busy <- struct{}{}
+	defer func() { <-m.busy }()
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		rwc.Close()
+		m.subs.close()
+		return nil
+	}
+	l := m.attach(rwc)
+	m.link = l
+	cmds := m.shadow.commands()
+	m.mu.Unlock()
+
+	for _, c := range cmds {
+		resp, _, err := m.roundTrip(context.Background(), l, c.req, c.payload)
+		if err == nil && resp != 0x40|c.req {
+			err = ErrFailed
+		}
+		if err != nil {
+			l.rwc.Close()
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.backoff = minReconnectBackoff
+	m.mu.Unlock()
+	return nil
+}
+
+// shadow records what the host has most recently asked the CFA635 to display,
+// so that a supervised Module can restore it after reconnecting.
+type shadow struct {
+	lcd          LCDState
+	cgram        [8][8]byte
+	cgramSet     uint8 // Bit i is set if the host has set sprite i
+	backlight    [2]int
+	backlightSet bool
+	gpio         [13]int
+	gpioSet      uint16 // Bit i is set if the host has set GPIO i
+	gpioMode     [13]GPIOMode
+	gpioModeSet  uint16 // Bit i is set if the host has configured GPIO i
+}
+
+func newShadow() shadow { return shadow{lcd: *ClearedLCDState()} }
+
+func (s *shadow) setGPIO(pin, duty int) {
+	s.gpio[pin] = duty
+	s.gpioSet |= 1 << pin
+}
+
+func (s *shadow) configureGPIO(pin, duty int, mode GPIOMode) {
+	s.setGPIO(pin, duty)
+	s.gpioMode[pin] = mode
+	s.gpioModeSet |= 1 << pin
+}
+
+// remember updates the shadow state.
+func (m *Module) remember(f func(*shadow)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f(&m.shadow)
+}
+
+type request struct {
+	req     byte
+	payload []byte
+}
+
+// commands returns the commands that bring a freshly booted CFA635 to the
+// shadow state.
+func (s *shadow) commands() []request {
+	cmds := []request{{0x06, nil}}
+	for i, c := range s.cgram {
+		if s.cgramSet&(1<<i) != 0 {
+			cmds = append(cmds, request{0x09, append([]byte{byte(i)}, c[:]...)})
+		}
+	}
+	blank := ClearedLCDState()
+	for y := range s.lcd {
+		if s.lcd[y] != blank[y] {
+			cmds = append(cmds, request{0x1f, append([]byte{0, byte(y)}, s.lcd[y][:]...)})
+		}
+	}
+	if s.backlightSet {
+		cmds = append(cmds, request{0x0e, []byte{byte(s.backlight[0]), byte(s.backlight[1])}})
+	}
+	for i, d := range s.gpio {
+		switch {
+		case s.gpioModeSet&(1<<i) != 0:
+			cmds = append(cmds, request{0x22, []byte{byte(i), byte(d), byte(s.gpioMode[i])}})
+		case s.gpioSet&(1<<i) != 0:
+			cmds = append(cmds, request{0x22, []byte{byte(i), byte(d)}})
+		}
+	}
+	return cmds
+}
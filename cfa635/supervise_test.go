@@ -0,0 +1,65 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/cfa635/cfa635test"
+)
+
+func TestDialRestoresGPIOMode(t *testing.T) {
+	emulators := make(chan *cfa635test.Emulator, 2)
+	m, err := cfa635.Dial(func() (io.ReadWriteCloser, error) {
+		e := cfa635test.NewEmulator()
+		emulators <- e
+		return e, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.ConfigureGPIO(2, 40, 0b0101); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetGPIO(2, 60); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetGPIO(3, 70); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unplug the CFA635 and wait for the Module to restore it.
+	(<-emulators).Close()
+	e := <-emulators
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if duty, _ := e.GPIO(3); duty == 70 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Module didn't restore the GPIO pins")
+		}
+	}
+	if duty, mode := e.GPIO(2); duty != 60 || mode != 0b0101 {
+		t.Errorf("GPIO 2 = %d%% in mode %#b, want 60%% in mode 0b101", duty, mode)
+	}
+	if _, mode := e.GPIO(3); mode != 0 {
+		t.Errorf("GPIO 3 mode = %#b, want the default", mode)
+	}
+}
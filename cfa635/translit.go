@@ -0,0 +1,179 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NewTransliterator returns a Transformer that converts UTF-8 to the CFA635
+// display character set, approximating code points the CFA635 can't display
+// instead of replacing them.
+//
+// For each code point, the returned Transformer tries, in order:
+//
+//   - the byte NewEncoder would produce, if it isn't the replacement character;
+//   - the code point with some or all of its combining marks removed, so that,
+//     for example, ǖ becomes ü and ą becomes a;
+//   - a Latin transliteration, so that, for example, Ж becomes Zh, œ becomes
+//     oe, and „ becomes ";
+//   - ¿, the replacement character.
+//
+// Combining marks that don't combine with anything the CFA635 can display are
+// dropped.
+//
+// Unlike NewEncoder, the returned Transformer does not produce one byte per
+// code point: transliterations can be several bytes long, and dropped marks
+// produce none. Callers that lay out text must measure the result, not the
+// input.
+func NewTransliterator() transform.Transformer {
+	return transform.Chain(norm.NFC, transliterate{})
+}
+
+type transliterate struct{}
+
+func (_ transliterate) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	var buf [utf8.UTFMax * 4]byte
+	for nSrc < len(src) {
+		if !atEOF && !utf8.FullRune(src[nSrc:]) {
+			err = transform.ErrShortSrc
+			break
+		}
+		r, rLen := utf8.DecodeRune(src[nSrc:])
+
+		out := transliterate1(buf[:0], r)
+		if nDst+len(out) > len(dst) {
+			err = transform.ErrShortDst
+			break
+		}
+		nDst += copy(dst[nDst:], out)
+		nSrc += rLen
+	}
+	return
+}
+
+func (_ transliterate) Reset() {}
+
+// transliterate1 appends the CFA635 representation of a code point to dst.
+func transliterate1(dst []byte, c rune) []byte {
+	if b, ok := exact(c); ok {
+		return append(dst, b)
+	}
+
+	// Try removing combining marks, first all but one and then all of them.
+	d := []rune(norm.NFD.String(string(c)))
+	if len(d) > 1 {
+		base := string(d[0])
+		for _, mark := range d[1:] {
+			if b, ok := exact(single(norm.NFC.String(base + string(mark)))); ok {
+				return append(dst, b)
+			}
+		}
+		if b, ok := exact(d[0]); ok {
+			return append(dst, b)
+		}
+	}
+
+	for _, c := range []rune{c, d[0]} {
+		if s, ok := transliterations[c]; ok {
+			for _, c := range s {
+				b, ok := exact(c)
+				if !ok {
+					b = 0x60 // ¿
+				}
+				dst = append(dst, b)
+			}
+			return dst
+		}
+	}
+
+	if unicode.Is(unicode.Mn, c) {
+		return dst
+	}
+	return append(dst, 0x60) // ¿
+}
+
+// exact returns the byte that represents a code point exactly, if there is one.
+func exact(c rune) (byte, bool) {
+	if unicode.Is(identityMapped, c) {
+		return byte(c), true
+	}
+	return lookup(c)
+}
+
+// single returns the only code point in s, or utf8.RuneError if s has more than
+// one.
+func single(s string) rune {
+	r, n := utf8.DecodeRuneInString(s)
+	if n != len(s) {
+		return utf8.RuneError
+	}
+	return r
+}
+
+// transliterations maps code points that the CFA635 can't display, even with
+// their combining marks removed, to text that it can.
+var transliterations = map[rune]string{
+	// Latin letters without decompositions
+	'Đ': "D", 'đ': "d", 'Ð': "D", 'ð': "d",
+	'Ħ': "H", 'ħ': "h",
+	'Ł': "L", 'ł': "l",
+	'Ŧ': "T", 'ŧ': "t",
+	'Þ': "Th", 'þ': "th",
+	'Ŋ': "Ng", 'ŋ': "ng",
+	'ĸ': "q", 'ſ': "s",
+
+	// Ligatures
+	'Œ': "OE", 'œ': "oe",
+	'Ĳ': "IJ", 'ĳ': "ij",
+	'ﬀ': "ff", 'ﬁ': "fi", 'ﬂ': "fl", 'ﬃ': "ffi", 'ﬄ': "ffl", 'ﬅ': "st", 'ﬆ': "st",
+
+	// Punctuation and symbols
+	'‛': "'", '„': "\"", '‟': "\"",
+	'—': "-", '―': "-",
+	'…': "...", '‥': "..",
+	'‼': "!!", '⁇': "??", '⁈': "?!", '⁉': "!?",
+	'×': "x", '÷': "/", '¾': "3/4",
+	'©': "(C)", '®': "(R)", '™': "TM", '℗': "(P)",
+	'€': "EUR", '₩': "W", '₹': "Rs", '₽': "R",
+	'¦': "|", '¨': "\"", '´': "'", '¸': ",", '·': ".",
+
+	// Greek letters missing from the character ROM
+	'Α': "A", 'Β': "V", 'Ε': "E", 'Ζ': "Z", 'Η': "I", 'Ι': "I", 'Κ': "K",
+	'Μ': "M", 'Ν': "N", 'Ο': "O", 'Ρ': "R", 'Τ': "T", 'Χ': "Ch",
+	'γ': "g", 'ζ': "z", 'η': "i", 'ι': "i", 'κ': "k", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'ρ': "r", 'σ': "s", 'ς': "s", 'υ': "y", 'φ': "f", 'χ': "ch",
+	'ψ': "ps", 'ω': "o",
+
+	// Cyrillic letters
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Ґ': "G", 'Д': "D", 'Е': "E",
+	'Є': "Ye", 'Ё': "Yo", 'Ж': "Zh", 'З': "Z", 'И': "I", 'І': "I",
+	'Ї': "Yi", 'Й': "Y", 'К': "K", 'Л': "L", 'М': "M", 'Н': "N", 'О': "O",
+	'П': "P", 'Р': "R", 'С': "S", 'Т': "T", 'У': "U", 'Ў': "U", 'Ф': "F",
+	'Х': "Kh", 'Ц': "Ts", 'Ч': "Ch", 'Ш': "Sh", 'Щ': "Shch", 'Ъ': "\"",
+	'Ы': "Y", 'Ь': "'", 'Э': "E", 'Ю': "Yu", 'Я': "Ya", 'Ђ': "Dj",
+	'Ј': "J", 'Љ': "Lj", 'Њ': "Nj", 'Ћ': "C", 'Џ': "Dz", 'Ѕ': "Dz",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'ґ': "g", 'д': "d", 'е': "e",
+	'є': "ye", 'ё': "yo", 'ж': "zh", 'з': "z", 'и': "i", 'і': "i",
+	'ї': "yi", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ў': "u", 'ф': "f",
+	'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "\"",
+	'ы': "y", 'ь': "'", 'э': "e", 'ю': "yu", 'я': "ya", 'ђ': "dj",
+	'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz", 'ѕ': "dz",
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package cfa635_test
+
+import (
+	"strings"
+	"testing"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"golang.org/x/text/transform"
+)
+
+func TestTransliterator(t *testing.T) {
+	for _, tc := range []struct {
+		name, in string
+		want     string // Decoded with NewDecoder
+	}{
+		{"ROM", "Ça va? Ñandú §5", "Ça va? Ñandú §5"},
+		{"decomposed", "Café", "Café"},
+		{"Polish", "Łódź", "Lódz"},
+		{"fewer marks", "ǖ ệ ő ą", "ü ê o a"},
+		{"dropped mark", "q̃x", "qx"},
+		{"Russian", "Москва", "Moskva"},
+		{"Ukrainian", "Жёлтий Щит Їжак", "Zhyoltiy Shchit Yizhak"},
+		{"Greek", "Ζωή και Χάος", "Zoi kαi Chαos"},
+		{"ligatures", "œuvre ﬁn ĳs", "oeuvre fin ijs"},
+		{"smart quotes", "„Hallo‟ ‛x", "\"Hallo\" 'x"},
+		{"ROM quotes", "“Hi”", "“Hi”"},
+		{"punctuation", "a — b…", "a - b..."},
+		{"CJK", "東京 ok", "¿¿ ok"},
+		{"invalid UTF-8", "\xff ok", "¿ ok"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			enc, _, err := transform.String(cfa635.NewTransliterator(), tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _, _ := transform.String(cfa635.NewDecoder(), enc); got != tc.want {
+				t.Errorf("transliterated %q to %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTransliteratorLength(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want int
+	}{
+		{"abc", 3},
+		{"東京", 2}, // Six bytes of UTF-8, two code points
+		{"Щ", 4},  // One code point, Shch
+		{"é", 1}, // Two code points, é
+		{strings.Repeat("Щé", 5000), 25000},
+	} {
+		got, _, err := transform.String(cfa635.NewTransliterator(), tc.in)
+		if err != nil {
+			t.Errorf("%.20q: %v", tc.in, err)
+		} else if len(got) != tc.want {
+			t.Errorf("transliterated %.20q to %d bytes, want %d", tc.in, len(got), tc.want)
+		}
+	}
+}
@@ -19,8 +19,12 @@ import (
 	"time"
 
 	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/display"
 )
 
+// Pieces of the big digits. blitClockDigit draws them as indices into
+// clockSprites, and the clock screen then replaces them with the characters that
+// GlyphManager assigns.
 const (
 	lowerHalfSprite = iota
 	upperHalfSprite
@@ -32,117 +36,91 @@ const (
 	rightLowerEdgeSprite
 )
 
-func initializeClockDisplay(lcd *cfa635.Module) error {
-	// Load sprites.
-
-	if err := lcd.SetCharacter(lowerHalfSprite, &[...]byte{
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_111111,
-		0b00_111111,
-		0b00_111111,
-	}); err != nil {
-		return err
-	}
-
-	if err := lcd.SetCharacter(upperHalfSprite, &[...]byte{
-		0b00_111111,
-		0b00_111111,
-		0b00_111111,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-	}); err != nil {
-		return err
-	}
-
-	if err := lcd.SetCharacter(lowerHalfEdgeSprite, &[...]byte{
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-	}); err != nil {
-		return err
-	}
-
-	if err := lcd.SetCharacter(upperHalfEdgeSprite, &[...]byte{
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-	}); err != nil {
-		return err
-	}
-
-	if err := lcd.SetCharacter(fullBlockSprite, &[...]byte{
-		0b00_111111,
-		0b00_111111,
-		0b00_111111,
-		0b00_111111,
-		0b00_111111,
-		0b00_111111,
-		0b00_111111,
-		0b00_111111,
-	}); err != nil {
-		return err
-	}
-
-	if err := lcd.SetCharacter(fullBlockEdgeSprite, &[...]byte{
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-	}); err != nil {
-		return err
-	}
-
-	if err := lcd.SetCharacter(lowerRightSprite, &[...]byte{
-		0b00_000001,
-		0b00_000011,
-		0b00_000111,
-		0b00_001111,
-		0b00_011111,
-		0b00_111111,
-		0b00_111111,
-		0b00_111111,
-	}); err != nil {
-		return err
-	}
-
-	if err := lcd.SetCharacter(rightLowerEdgeSprite, &[...]byte{
-		0b00_000001,
-		0b00_000011,
-		0b00_000111,
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-		0b00_001111,
-	}); err != nil {
-		return err
-	}
-
-	return nil
+// clockSprites holds the bitmaps of the pieces of the big digits.
+var clockSprites = [...]*cfa635.Sprite{
+	lowerHalfSprite: cfa635.MustParseSprite(`
+		......
+		......
+		......
+		......
+		......
+		######
+		######
+		######
+	`),
+	upperHalfSprite: cfa635.MustParseSprite(`
+		######
+		######
+		######
+		......
+		......
+		......
+		......
+		......
+	`),
+	lowerHalfEdgeSprite: cfa635.MustParseSprite(`
+		......
+		......
+		......
+		......
+		......
+		..####
+		..####
+		..####
+	`),
+	upperHalfEdgeSprite: cfa635.MustParseSprite(`
+		..####
+		..####
+		..####
+		......
+		......
+		......
+		......
+		......
+	`),
+	fullBlockSprite: cfa635.MustParseSprite(`
+		######
+		######
+		######
+		######
+		######
+		######
+		######
+		######
+	`),
+	fullBlockEdgeSprite: cfa635.MustParseSprite(`
+		..####
+		..####
+		..####
+		..####
+		..####
+		..####
+		..####
+		..####
+	`),
+	lowerRightSprite: cfa635.MustParseSprite(`
+		.....#
+		....##
+		...###
+		..####
+		.#####
+		######
+		######
+		######
+	`),
+	rightLowerEdgeSprite: cfa635.MustParseSprite(`
+		.....#
+		....##
+		...###
+		..####
+		..####
+		..####
+		..####
+		..####
+	`),
 }
 
-func blitClockDigit(n int, lcd *cfa635.LCDState, x int) {
+func blitClockDigit(n int, lcd display.Frame, x int) {
 	switch n {
 	case 0:
 		lcd[0][x] = rightLowerEdgeSprite
@@ -268,11 +246,45 @@ func blitClockDigit(n int, lcd *cfa635.LCDState, x int) {
 	}
 }
 
-func clockView(now time.Time) *view {
+// The clock shows when MPD has been idle for a while.
+const clockPriority = 10
+
+type clockScreen struct{}
+
+func init() { registerScreen("clock", clockScreen{}) }
+
+func (clockScreen) priority(*screenContext) (int, time.Time) { return clockPriority, time.Time{} }
+
+// sprites returns the pieces of the big digits, if there's room for them.
+func (clockScreen) sprites(c *screenContext) []*cfa635.Sprite {
+	if c.cols < 20 || c.rows < 4 {
+		return nil
+	}
+	return clockSprites[:]
+}
+
+func (clockScreen) handleKey(*screenContext, *cfa635.GestureEvent) bool { return false }
+
+// render draws the clock, requesting the sprites it needs from c.glyphs.
+func (clockScreen) render(c *screenContext, _ *view) *view {
+	now, glyphs, cols, rows := c.now, c.glyphs, c.cols, c.rows
+
 	var new view
-	new.LCD = cfa635.ClearedLCDState()
+	new.LCD = display.NewFrame(cols, rows)
+	new.Next = now.Truncate(time.Second).Add(time.Second)
+	new.DisplayBrightness = float64(conf.IdleBrightness)
 
 	now = now.Local()
+	if cols < 20 || rows < 4 {
+		// There isn't room for big digits, so just center the time.
+		t := encode(now.Format("3:04:05 pm"))
+		if len(t) > cols {
+			t = t[:cols]
+		}
+		copy(new.LCD[(rows-1)/2][(cols-len(t))/2:], t)
+		return &new
+	}
+
 	h := now.Hour() % 12
 	if h == 0 {
 		h = 12
@@ -304,5 +316,13 @@ func clockView(now time.Time) *view {
 	}
 	new.LCD[3][19] = 'm'
 
+	for _, row := range new.LCD {
+		for x, c := range row {
+			if int(c) < len(clockSprites) {
+				row[x] = sprite(glyphs, clockSprites[c], ' ')
+			}
+		}
+	}
+
 	return &new
 }
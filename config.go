@@ -0,0 +1,306 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// config holds audiotrond's settings. They come from a JSON file whose keys
+// match the field names, for example
+//
+// 	{
+// 		"Device": "/dev/ttyUSB0",
+// 		"MPD": {"Network": "tcp", "Address": "localhost:6600"},
+// 		"ClockAfter": "1m",
+// 		"Screens": ["mpd"]
+// 	}
+//
+// and from command-line flags, which take precedence. Settings missing from
+// both keep the values from defaultConfig.
+type config struct {
+	Display string // "cfa635" or "terminal"
+	Device  string // Serial port for the CFA635
+	Baud    int
+
+	MPD struct {
+		Network  string // "unix" or "tcp"
+		Address  string
+		Password string
+	}
+
+	// How long after playback stops or pauses the backlight starts to dim
+	// and the clock replaces the MPD screen
+	DimAfter   duration
+	ClockAfter duration
+
+	// Backlight brightness during and after playback, and while idle, from
+	// 0 to 100, inclusive, and the rate at which it changes between them,
+	// in percent per second
+	Brightness     int
+	IdleBrightness int
+	RampRate       float64
+
+	// How long an overlay shows a change in volume, random or repeat mode,
+	// or position in the current track, or 0 to show none
+	OverlayDuration duration
+
+	// The screens to show: any of "mpd", "clock", and "menu"
+	Screens stringList
+
+	// How long a key must be held to make a long press
+	LongPress duration
+
+	// What each key does, by key name ("up", "down", "left", "right",
+	// "enter", or "exit"), optionally prefixed with "long-" or "double-",
+	// or by two key names joined by "+" for a chord. Actions are the
+	// names in keyActions, which issue MPD commands, and in
+	// screenActions, which screens perform; -help lists them.
+	// Keys missing from the map keep their default actions.
+	Keys keyMap
+}
+
+func defaultConfig() *config {
+	c := &config{
+		Display:         "cfa635",
+		Device:          "/dev/lcd",
+		Baud:            115200,
+		DimAfter:        duration(15 * time.Second),
+		ClockAfter:      duration(17 * time.Second),
+		Brightness:      20,
+		IdleBrightness:  0,
+		RampRate:        40,
+		OverlayDuration: duration(2 * time.Second),
+		Screens:         stringList{"mpd", "clock", "menu"},
+		LongPress:       duration(600 * time.Millisecond),
+		Keys:            defaultKeyMap(),
+	}
+	c.MPD.Network = "unix"
+	c.MPD.Address = "/run/mpd/socket"
+	return c
+}
+
+// register defines flags on fs that set the fields of c.
+func (c *config) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.Display, "display", c.Display, `where to draw: "cfa635" for the module on -device, or "terminal" to simulate it on standard output`)
+	fs.StringVar(&c.Device, "device", c.Device, "serial port for the CFA635")
+	fs.IntVar(&c.Baud, "baud", c.Baud, "CFA635 baud rate: 19200 or 115200")
+	fs.StringVar(&c.MPD.Network, "mpd-network", c.MPD.Network, `how to reach MPD: "unix" or "tcp"`)
+	fs.StringVar(&c.MPD.Address, "mpd-address", c.MPD.Address, "MPD socket path or host:port")
+	fs.StringVar(&c.MPD.Password, "mpd-password", c.MPD.Password, "MPD password")
+	fs.Var(&c.DimAfter, "dim-after", "how long after playback stops to dim the backlight")
+	fs.Var(&c.ClockAfter, "clock-after", "how long after playback stops to show the clock")
+	fs.IntVar(&c.Brightness, "brightness", c.Brightness, "backlight brightness during playback, from 0 to 100")
+	fs.IntVar(&c.IdleBrightness, "idle-brightness", c.IdleBrightness, "backlight brightness while idle, from 0 to 100")
+	fs.Float64Var(&c.RampRate, "ramp-rate", c.RampRate, "backlight brightness change rate, in percent per second")
+	fs.Var(&c.OverlayDuration, "overlay-duration", "how long to show changes in volume, modes, and position, or 0 for never")
+	fs.Var(&c.Screens, "screens", `comma-separated screens to show: any of "mpd", "clock", and "menu"`)
+	fs.Var(&c.LongPress, "long-press", "how long to hold a key for a long press")
+	fs.Var(&c.Keys, "keys", "comma-separated key=action pairs to change what keys do, like `exit=none,enter=stop`; actions are "+strings.Join(actionNames(), ", "))
+}
+
+// ErrConfig is the error that loadConfig wraps when a setting is invalid.
+var ErrConfig = errors.New("invalid configuration")
+
+// loadConfig reads the configuration file at path and then applies the flags
+// that were set in fs, which must have been registered with register. A
+// missing file is an error only if fs has a -config flag that was set.
+func loadConfig(path string, fs *flag.FlagSet) (*config, error) {
+	var explicit bool
+	fs.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "config" })
+
+	c := defaultConfig()
+	f, err := os.Open(path)
+	switch {
+	case err == nil:
+		d := json.NewDecoder(f)
+		d.DisallowUnknownFields()
+		err = d.Decode(c)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrConfig, path, err)
+		}
+	case explicit || !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	overrides := flag.NewFlagSet("", flag.ContinueOnError)
+	c.register(overrides)
+	var setErr error
+	fs.Visit(func(f *flag.Flag) {
+		if setErr == nil && overrides.Lookup(f.Name) != nil {
+			setErr = overrides.Set(f.Name, f.Value.String())
+		}
+	})
+	if setErr != nil {
+		return nil, setErr
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
+	}
+	return c, nil
+}
+
+func (c *config) validate() error {
+	switch c.Display {
+	case "cfa635":
+		if c.Device == "" {
+			return errors.New("no CFA635 device")
+		}
+		if c.Baud != 19200 && c.Baud != 115200 {
+			return fmt.Errorf("baud rate %d is neither 19200 nor 115200", c.Baud)
+		}
+	case "terminal":
+	default:
+		return fmt.Errorf("unknown display %q", c.Display)
+	}
+
+	if c.usesMPD() {
+		if c.MPD.Network != "unix" && c.MPD.Network != "tcp" {
+			return fmt.Errorf("unknown MPD network %q", c.MPD.Network)
+		}
+		if c.MPD.Address == "" {
+			return errors.New("no MPD address")
+		}
+	}
+
+	if c.DimAfter < 0 || c.ClockAfter < 0 || c.OverlayDuration < 0 {
+		return errors.New("negative screen timeout")
+	}
+	for _, b := range []int{c.Brightness, c.IdleBrightness} {
+		if b < 0 || b > 100 {
+			return fmt.Errorf("brightness %d is not between 0 and 100", b)
+		}
+	}
+	if c.IdleBrightness > c.Brightness {
+		return errors.New("idle brightness exceeds brightness")
+	}
+	if !(c.RampRate > 0) {
+		return fmt.Errorf("brightness ramp rate %v is not positive", c.RampRate)
+	}
+	if c.LongPress <= 0 {
+		return fmt.Errorf("long-press time %v is not positive", c.LongPress)
+	}
+
+	for k, a := range c.Keys {
+		if err := checkKeyName(k); err != nil {
+			return err
+		}
+		if !knownAction(a) {
+			return fmt.Errorf("unknown action %q for key %q", a, k)
+		}
+	}
+
+	if len(c.Screens) == 0 {
+		return errors.New("no screens enabled")
+	}
+	seen := make(map[string]bool)
+	for _, s := range c.Screens {
+		if !knownScreen(s) {
+			return fmt.Errorf("unknown screen %q", s)
+		}
+		if seen[s] {
+			return fmt.Errorf("screen %q listed twice", s)
+		}
+		seen[s] = true
+	}
+	return nil
+}
+
+// enabled reports whether the screen with the given name is enabled.
+func (c *config) enabled(screen string) bool {
+	for _, s := range c.Screens {
+		if s == screen {
+			return true
+		}
+	}
+	return false
+}
+
+// duration is a time.Duration that reads and writes strings like "17s", both in
+// JSON and as a flag.
+type duration time.Duration
+
+func (d duration) String() string { return time.Duration(d).String() }
+
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) { return json.Marshal(d.String()) }
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.Set(s)
+}
+
+// stringList is a list of strings that reads a comma-separated list as a flag.
+type stringList []string
+
+func (l stringList) String() string { return strings.Join(l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = nil
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// keyMap maps key names to action names. As a flag, it reads a comma-separated
+// list of key=action pairs and adds them to the map.
+type keyMap map[string]string
+
+func (m keyMap) String() string {
+	var pairs []string
+	for k, a := range m {
+		pairs = append(pairs, k+"="+a)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *keyMap) Set(s string) error {
+	if *m == nil {
+		*m = make(keyMap)
+	}
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		k, a, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("%q is not a key=action pair", pair)
+		}
+		(*m)[k] = a
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigMissingDefaultFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audiotrond.json")
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.String("config", path, "")
+	defaultConfig().register(fs)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadConfig(path, fs)
+	if err != nil {
+		t.Fatalf("loadConfig with no file and no flags: %v", err)
+	}
+	if c.Baud != defaultConfig().Baud {
+		t.Errorf("Baud = %d, want the default %d", c.Baud, defaultConfig().Baud)
+	}
+
+	if err := fs.Set("config", path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path, fs); err == nil {
+		t.Error("loadConfig succeeded with a missing file named by -config")
+	}
+}
+
+func TestLoadConfigKeepsFirstFlagError(t *testing.T) {
+	// -brightness sorts before -dim-after, so fs.Visit sets it first.
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.String("brightness", "", "")
+	fs.String("dim-after", "", "")
+	if err := fs.Parse([]string{"-brightness", "bright", "-dim-after", "3s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.json"), fs); err == nil {
+		t.Error("loadConfig succeeded with -brightness=bright")
+	}
+}
+
+func TestValidateKeyActions(t *testing.T) {
+	for _, a := range actionNames() {
+		a, _ := strconv.Unquote(a)
+		c := defaultConfig()
+		c.Keys = keyMap{"enter": a}
+		if err := c.validate(); err != nil {
+			t.Errorf("enter=%s: %v", a, err)
+		}
+	}
+
+	c := defaultConfig()
+	c.Keys = keyMap{"enter": "dance"}
+	if err := c.validate(); err == nil {
+		t.Error("validate accepted enter=dance")
+	}
+}
+
+func TestKeysUsageListsActions(t *testing.T) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	defaultConfig().register(fs)
+	usage := fs.Lookup("keys").Usage
+	for _, a := range []string{`"none"`, `"play-pause"`, `"menu"`, `"details"`} {
+		if !strings.Contains(usage, a) {
+			t.Errorf("-keys usage %q doesn't mention %s", usage, a)
+		}
+	}
+}
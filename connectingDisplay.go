@@ -0,0 +1,68 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/display"
+)
+
+// The connecting screen shows while audiotrond can't reach MPD.
+const connectingPriority = 30
+
+type connectingScreen struct{}
+
+func init() { registerScreen("", connectingScreen{}) }
+
+func (connectingScreen) priority(c *screenContext) (int, time.Time) {
+	if !wantsMPD() || c.conn.connected() {
+		return 0, time.Time{}
+	}
+	return connectingPriority, time.Time{}
+}
+
+func (connectingScreen) sprites(*screenContext) []*cfa635.Sprite { return nil }
+
+func (connectingScreen) handleKey(*screenContext, *cfa635.GestureEvent) bool { return false }
+
+// render draws a status message with the time beneath it. The backlight stays
+// as it was.
+func (connectingScreen) render(c *screenContext, old *view) *view {
+	now, glyphs, cols, rows := c.now, c.glyphs, c.cols, c.rows
+
+	var new view
+	new.LCD = display.NewFrame(cols, rows)
+	new.Next = now.Truncate(time.Second).Add(time.Second)
+	new.DisplayBrightness = old.DisplayBrightness
+
+	center := func(row int, s []byte) {
+		if len(s) > cols {
+			s = s[:cols]
+		}
+		copy(new.LCD[row][(cols-len(s))/2:], s)
+	}
+	row := (rows - 1) / 2
+	msg := glyphs.Encode("Connecting to MPD…")
+	if len(msg) > cols {
+		msg = encode("Connecting…")
+	}
+	center(row, msg)
+	if row+1 < rows {
+		center(row+1, encode(now.Local().Format("3:04:05 pm")))
+	}
+	return &new
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package display
+
+import (
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+// CFA635 is a Display backed by a Crystalfontz CFA635.
+type CFA635 struct {
+	m    *cfa635.Module
+	keys chan *KeyEvent
+}
+
+// cfa635Keys maps the CFA635's keys to a Display's.
+var cfa635Keys = map[cfa635.Key]Key{
+	cfa635.UpButton:    UpKey,
+	cfa635.DownButton:  DownKey,
+	cfa635.LeftButton:  LeftKey,
+	cfa635.RightButton: RightKey,
+	cfa635.EnterButton: EnterKey,
+	cfa635.ExitButton:  ExitKey,
+}
+
+// NewCFA635 adapts a CFA635 module to the Display interface. The Display takes
+// ownership of the module.
+func NewCFA635(m *cfa635.Module) *CFA635 {
+	d := &CFA635{m: m, keys: make(chan *KeyEvent, 16)}
+
+	reports := m.Subscribe(16)
+	go func() {
+		defer close(d.keys)
+		for r := range reports.C {
+			if a, ok := r.(*cfa635.KeyActivity); ok {
+				if k, ok := cfa635Keys[a.K]; ok {
+					d.keys <- &KeyEvent{K: k, Pressed: a.Pressed}
+				}
+			}
+		}
+	}()
+
+	return d
+}
+
+func (d *CFA635) Size() (cols, rows int) { return 20, 4 }
+
+func (d *CFA635) Put(col, row int, data []byte) error { return d.m.Put(col, row, data) }
+
+func (d *CFA635) Clear() error { return d.m.Clear() }
+
+func (d *CFA635) SetCharacter(i int, data *[8]byte) error { return d.m.SetCharacter(i, data) }
+
+// SetBacklight sets the LCD backlight and turns off the keypad backlight.
+func (d *CFA635) SetBacklight(brightness int) error { return d.m.SetBacklight(brightness, 0) }
+
+func (d *CFA635) LEDs() int { return 4 }
+
+func (d *CFA635) SetLED(led int, green bool, duty int) error { return d.m.SetLED(led, green, duty) }
+
+func (d *CFA635) Keys() <-chan *KeyEvent { return d.keys }
+
+func (d *CFA635) Close() error {
+	d.m.Close()
+	return nil
+}
+
+// Update uses cfa635.Update to transform the display. It leaves the keypad
+// backlight off and leaves special characters to SetCharacter.
+func (d *CFA635) Update(old, new *State) error {
+	o, n := moduleState(old), moduleState(new)
+	for led := range n.LEDs {
+		switch {
+		case led >= len(new.LEDs):
+			n.LEDs[led] = o.LEDs[led]
+		case led >= len(old.LEDs):
+			o.LEDs[led] = [2]int{-1, -1} // Unknown, so always set
+		}
+	}
+	return cfa635.Update(d.m, o, n)
+}
+
+func moduleState(s *State) *cfa635.State {
+	r := cfa635.ClearedState()
+	for y := range r.LCD {
+		copy(r.LCD[y][:], s.Frame[y])
+	}
+	r.Backlight = s.Backlight
+	copy(r.LEDs[:], s.LEDs)
+	return r
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+// Package display abstracts over character LCDs with custom glyphs, a
+// backlight, indicator LEDs, and keys.
+//
+// Text sent to a Display is always in the CFA635 character set (see
+// cfa635.NewEncoder), and keys are always the CFA635's six. A Display for a
+// panel with a different character ROM or keypad translates them.
+package display
+
+import (
+	"strings"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+// Display is a character LCD.
+type Display interface {
+	// Size returns the number of columns and rows of characters on the
+	// display.
+	Size() (cols, rows int)
+
+	// Put writes data to the display at a column and row. No wrapping
+	// occurs; if the data are too large, they are truncated.
+	Put(col, row int, data []byte) error
+
+	// Clear fills the display with spaces.
+	Clear() error
+
+	// SetCharacter loads a sprite into one of the eight custom glyph slots,
+	// after which byte i displays it. The sprite has the format accepted by
+	// cfa635.Module.SetCharacter; displays with five-pixel-wide cells
+	// ignore the leftmost column.
+	SetCharacter(i int, data *[8]byte) error
+
+	// SetBacklight sets the backlight brightness, from 0 (off) to 100
+	// (full), inclusive.
+	SetBacklight(brightness int) error
+
+	// LEDs returns the number of red/green indicator LEDs on the display.
+	LEDs() int
+
+	// SetLED sets the red or green component of an indicator LED to a duty
+	// cycle between 0 and 100, inclusive.
+	SetLED(led int, green bool, duty int) error
+
+	// Keys returns a channel of key presses and releases, or nil if the
+	// display has no keys.
+	Keys() <-chan *KeyEvent
+
+	// Close releases the display.
+	Close() error
+}
+
+// Key is a key on a display's keypad.
+type Key int
+
+const (
+	_ Key = iota
+	UpKey
+	DownKey
+	LeftKey
+	RightKey
+	EnterKey
+	ExitKey
+)
+
+// KeyEvent reports that a key has been pressed or released.
+type KeyEvent struct {
+	K       Key
+	Pressed bool
+}
+
+// Updater is implemented by displays that can transform themselves from one
+// State to another more efficiently than Update's generic diff.
+type Updater interface {
+	Update(old, new *State) error
+}
+
+// State is what a program controls on a Display: its contents, its backlight,
+// and its LEDs.
+type State struct {
+	Frame     Frame
+	Backlight int // From 0 to 100, inclusive
+
+	// Red and green duty cycles of the LEDs, as for SetLED. LEDs past the
+	// end of the slice are left alone.
+	LEDs [][2]int
+}
+
+// Frame is the contents of a display, indexed by row and then column.
+type Frame [][]byte
+
+// NewFrame returns a Frame of the given size filled with spaces.
+func NewFrame(cols, rows int) Frame {
+	f := make(Frame, rows)
+	for y := range f {
+		f[y] = make([]byte, cols)
+		for x := range f[y] {
+			f[y][x] = 0x20
+		}
+	}
+	return f
+}
+
+// Size returns the number of columns and rows in the Frame.
+func (f Frame) Size() (cols, rows int) {
+	if len(f) == 0 {
+		return 0, 0
+	}
+	return len(f[0]), len(f)
+}
+
+// String returns the Frame as lines of text, converted to Unicode as by
+// cfa635.NewDecoder.
+func (f Frame) String() string {
+	var b strings.Builder
+	for y, row := range f {
+		if y > 0 {
+			b.WriteByte('\n')
+		}
+		for _, c := range row {
+			b.WriteRune(cfa635.DecodeCharacter(c))
+		}
+	}
+	return b.String()
+}
+
+// Update sends d the commands that change it from old to new, whose frames
+// must both match the size of d. It sets any LED that new lists but old
+// doesn't. If d implements Updater, Update defers to it.
+func Update(d Display, old, new *State) error {
+	if u, ok := d.(Updater); ok {
+		return u.Update(old, new)
+	}
+
+	if err := updateFrame(d, old.Frame, new.Frame); err != nil {
+		return err
+	}
+	if new.Backlight != old.Backlight {
+		if err := d.SetBacklight(new.Backlight); err != nil {
+			return err
+		}
+	}
+	for led, duty := range new.LEDs {
+		for i := range duty {
+			if led < len(old.LEDs) && duty[i] == old.LEDs[led][i] {
+				continue
+			}
+			if err := d.SetLED(led, i == 1, duty[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateFrame writes the changed part of each row.
+func updateFrame(d Display, old, new Frame) error {
+	for y := range old {
+		var first, last int
+
+		for ; first < len(old[y]) && new[y][first] == old[y][first]; first++ {
+		}
+		if first == len(old[y]) {
+			continue
+		}
+
+		for last = len(old[y]) - 1; last > first && new[y][last] == old[y][last]; last-- {
+		}
+		if err := d.Put(first, y, new[y][first:last+1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PutWrapped writes data to d starting at a column and row, wrapping onto
+// subsequent rows and stopping at the bottom of the display.
+func PutWrapped(d Display, col, row int, data []byte) error {
+	cols, rows := d.Size()
+	for row < rows && len(data) > 0 {
+		if err := d.Put(col, row, data); err != nil {
+			return err
+		}
+		if len(data) <= cols-col {
+			data = nil
+		} else {
+			data = data[cols-col:]
+		}
+		col = 0
+		row++
+	}
+	return nil
+}
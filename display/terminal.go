@@ -0,0 +1,333 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package display
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+const (
+	// escDelay is how long the Terminal waits after an escape byte for the
+	// rest of an escape sequence before deciding the Escape key was
+	// pressed.
+	escDelay = 50 * time.Millisecond
+)
+
+// Colors of the simulated LCD, as RGB triples
+var (
+	backlightOn  = [3]int{0x9a, 0xd4, 0x2a} // Yellow-green
+	backlightOff = [3]int{0x30, 0x38, 0x28}
+	pixelOn      = [3]int{0x10, 0x20, 0x10}
+	ledOff       = [3]int{0x40, 0x40, 0x40}
+)
+
+// quadrants maps a set of lit quadrants (bit 0 top left, bit 1 top right, bit
+// 2 bottom left, bit 3 bottom right) to a Unicode block element.
+var quadrants = [16]rune{' ', '▘', '▝', '▀', '▖', '▌', '▞', '▛', '▗', '▚', '▐', '▜', '▄', '▙', '▟', '█'}
+
+// Terminal is a Display that simulates a CFA635 in an ANSI terminal, for
+// developing screens without the hardware. It draws the LCD with its
+// backlight and four LEDs, approximating custom glyphs with block elements,
+// and maps the arrow, Enter, and Escape keys to the CFA635's keys.
+type Terminal struct {
+	in   *os.File
+	keys chan *KeyEvent
+	stty string // Terminal settings to restore on Close
+
+	mu        sync.Mutex // Guards the fields below
+	out       *bufio.Writer
+	lcd       Frame
+	cgram     [8][8]byte
+	backlight int
+	leds      [4][2]int // Red and green duty cycles
+}
+
+// NewTerminal starts simulating a CFA635 on a terminal. It puts the terminal
+// in cbreak mode; Close restores the original settings.
+func NewTerminal(in *os.File, out io.Writer) (*Terminal, error) {
+	stty, err := runSTTY(in, "-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runSTTY(in, "-icanon", "-echo", "min", "1", "time", "0"); err != nil {
+		return nil, err
+	}
+
+	t := &Terminal{
+		in:        in,
+		keys:      make(chan *KeyEvent, 16),
+		stty:      strings.TrimSpace(stty),
+		out:       bufio.NewWriter(out),
+		lcd:       NewFrame(20, 4),
+		backlight: 100,
+	}
+
+	// Switch to the alternate screen and hide the cursor.
+	t.out.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+	t.mu.Lock()
+	t.redraw()
+	t.mu.Unlock()
+
+	go t.readKeys()
+	return t, nil
+}
+
+func runSTTY(in *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = in
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("stty %s: %w", strings.Join(args, " "), err)
+	}
+	return out.String(), nil
+}
+
+func (t *Terminal) Size() (cols, rows int) { return t.lcd.Size() }
+
+func (t *Terminal) Put(col, row int, data []byte) error {
+	if cols, rows := t.lcd.Size(); col < 0 || col >= cols || row < 0 || row >= rows {
+		return cfa635.ErrPosition
+	}
+	return t.update(func() { copy(t.lcd[row][col:], data) })
+}
+
+func (t *Terminal) Clear() error {
+	return t.update(func() { t.lcd = NewFrame(t.lcd.Size()) })
+}
+
+func (t *Terminal) SetCharacter(i int, data *[8]byte) error {
+	if i < 0 || i > 7 {
+		return cfa635.ErrCGRAM
+	}
+	return t.update(func() { t.cgram[i] = *data })
+}
+
+func (t *Terminal) SetBacklight(brightness int) error {
+	if brightness < 0 || brightness > 100 {
+		return cfa635.ErrBacklight
+	}
+	return t.update(func() { t.backlight = brightness })
+}
+
+func (t *Terminal) LEDs() int { return len(t.leds) }
+
+func (t *Terminal) SetLED(led int, green bool, duty int) error {
+	if led < 0 || led >= len(t.leds) {
+		return cfa635.ErrLEDIndex
+	}
+	if duty < 0 || duty > 100 {
+		return cfa635.ErrLEDDuty
+	}
+	return t.update(func() {
+		if green {
+			t.leds[led][1] = duty
+		} else {
+			t.leds[led][0] = duty
+		}
+	})
+}
+
+func (t *Terminal) Keys() <-chan *KeyEvent { return t.keys }
+
+// Close restores the terminal to its original state.
+func (t *Terminal) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+	if err := t.out.Flush(); err != nil {
+		return err
+	}
+	_, err := runSTTY(t.in, t.stty)
+	return err
+}
+
+// Update redraws the terminal once for the whole state.
+func (t *Terminal) Update(old, new *State) error {
+	return t.update(func() {
+		for y := range t.lcd {
+			copy(t.lcd[y], new.Frame[y])
+		}
+		t.backlight = new.Backlight
+		copy(t.leds[:], new.LEDs)
+	})
+}
+
+// update changes the simulated state and redraws the terminal.
+func (t *Terminal) update(f func()) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f()
+	return t.redraw()
+}
+
+// redraw draws the whole simulated module. The caller must hold t.mu.
+func (t *Terminal) redraw() error {
+	bg := mix(backlightOff, backlightOn, t.backlight)
+	fg := pixelOn
+
+	t.out.WriteString("\x1b[H")
+	t.out.WriteString("    ┌" + strings.Repeat("─", len(t.lcd[0])) + "┐\r\n")
+	for y, row := range t.lcd {
+		t.out.WriteString("  ")
+		t.writeLED(y)
+		t.out.WriteString(" │")
+		fmt.Fprintf(t.out, "\x1b[48;2;%d;%d;%dm\x1b[38;2;%d;%d;%dm", bg[0], bg[1], bg[2], fg[0], fg[1], fg[2])
+		for _, b := range row {
+			t.out.WriteRune(t.glyph(b))
+		}
+		t.out.WriteString("\x1b[0m│\r\n")
+	}
+	t.out.WriteString("    └" + strings.Repeat("─", len(t.lcd[0])) + "┘\r\n")
+	return t.out.Flush()
+}
+
+// writeLED draws one of the bicolor LEDs. The caller must hold t.mu.
+func (t *Terminal) writeLED(led int) {
+	red, green := t.leds[led][0], t.leds[led][1]
+	if red == 0 && green == 0 {
+		fmt.Fprintf(t.out, "\x1b[38;2;%d;%d;%dm○\x1b[0m", ledOff[0], ledOff[1], ledOff[2])
+		return
+	}
+	fmt.Fprintf(t.out, "\x1b[38;2;%d;%d;0m●\x1b[0m", red*255/100, green*255/100)
+}
+
+// glyph returns a rune that resembles a character on the CFA635. The caller
+// must hold t.mu.
+func (t *Terminal) glyph(b byte) rune {
+	if b < 0x10 {
+		return spriteGlyph(&t.cgram[b&0x07])
+	}
+	return cfa635.DecodeCharacter(b)
+}
+
+// spriteGlyph approximates a six-by-eight sprite with a quadrant block element.
+// A quadrant appears lit if at least a quarter of its pixels are.
+func spriteGlyph(s *[8]byte) rune {
+	var q int
+	for i := 0; i < 4; i++ {
+		var n int
+		for y := i / 2 * 4; y < i/2*4+4; y++ {
+			for x := i % 2 * 3; x < i%2*3+3; x++ {
+				if s[y]&(0b100000>>x) != 0 {
+					n++
+				}
+			}
+		}
+		if 4*n >= 12 {
+			q |= 1 << i
+		}
+	}
+	return quadrants[q]
+}
+
+// mix interpolates between two colors.
+func mix(off, on [3]int, percent int) [3]int {
+	var c [3]int
+	for i := range c {
+		c[i] = off[i] + (on[i]-off[i])*percent/100
+	}
+	return c
+}
+
+// readKeys translates terminal input into key activity. Terminals report only
+// key presses, so each press is immediately followed by a release.
+func (t *Terminal) readKeys() {
+	defer close(t.keys)
+
+	bytes := make(chan byte)
+	go func() {
+		defer close(bytes)
+		r := bufio.NewReader(t.in)
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			bytes <- b
+		}
+	}()
+
+	for b := range bytes {
+		var k Key
+		switch b {
+		case '\r', '\n':
+			k = EnterKey
+		case 0x1b:
+			k = t.readEscape(bytes)
+		}
+		if k != 0 {
+			t.press(k)
+		}
+	}
+}
+
+// readEscape reads the rest of an escape sequence, returning the key it
+// represents or 0 if it does not represent a key. A lone escape byte is the
+// Escape key.
+func (t *Terminal) readEscape(bytes <-chan byte) Key {
+	next := func() (byte, bool) {
+		select {
+		case b, ok := <-bytes:
+			return b, ok
+		case <-time.After(escDelay):
+			return 0, false
+		}
+	}
+
+	b, ok := next()
+	if !ok {
+		return ExitKey
+	}
+	if b != '[' && b != 'O' {
+		return 0
+	}
+	if b, ok = next(); !ok {
+		return 0
+	}
+	switch b {
+	case 'A':
+		return UpKey
+	case 'B':
+		return DownKey
+	case 'C':
+		return RightKey
+	case 'D':
+		return LeftKey
+	}
+	return 0
+}
+
+// press reports that k was pressed and released. If the buffer lacks room for
+// both events because nobody is reading them, press drops both, so readers
+// never see a press without its release. readKeys is the only sender, so the
+// room can't shrink between the check and the sends.
+func (t *Terminal) press(k Key) {
+	if cap(t.keys)-len(t.keys) < 2 {
+		return
+	}
+	t.keys <- &KeyEvent{K: k, Pressed: true}
+	t.keys <- &KeyEvent{K: k, Pressed: false}
+}
@@ -0,0 +1,303 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/display"
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+const (
+	// volumeStep is how much the volume keys change the volume, in
+	// percent.
+	volumeStep = 5
+
+	// seekStep is how far the seek keys move in the current track.
+	seekStep = 5 * time.Second
+)
+
+// moduleKeys maps a display's keys to the CFA635's, which cfa635.Gestures
+// recognizes.
+var moduleKeys = map[display.Key]cfa635.Key{
+	display.UpKey:    cfa635.UpButton,
+	display.DownKey:  cfa635.DownButton,
+	display.LeftKey:  cfa635.LeftButton,
+	display.RightKey: cfa635.RightButton,
+	display.EnterKey: cfa635.EnterButton,
+	display.ExitKey:  cfa635.ExitButton,
+}
+
+// keyActivity converts a display's key events to KeyActivity reports for
+// cfa635.Gestures. It closes the returned channel once events is closed.
+func keyActivity(events <-chan *display.KeyEvent) <-chan *cfa635.KeyActivity {
+	r := make(chan *cfa635.KeyActivity)
+	go func() {
+		defer close(r)
+		for e := range events {
+			if k, ok := moduleKeys[e.K]; ok {
+				r <- &cfa635.KeyActivity{K: k, Pressed: e.Pressed}
+			}
+		}
+	}()
+	return r
+}
+
+// keyNames maps the names used in the key map to the CFA635's keys.
+var keyNames = map[string]cfa635.Key{
+	"up":    cfa635.UpButton,
+	"down":  cfa635.DownButton,
+	"left":  cfa635.LeftButton,
+	"right": cfa635.RightButton,
+	"enter": cfa635.EnterButton,
+	"exit":  cfa635.ExitButton,
+}
+
+// keyActions maps the names used in the key map to the MPD commands they
+// issue. Each returns a short description of what it did.
+var keyActions = map[string]func(*mpd.Client, *model) (string, error){
+	"none": func(*mpd.Client, *model) (string, error) { return "", nil },
+
+	"play-pause": func(c *mpd.Client, m *model) (string, error) {
+		switch m.State {
+		case playing:
+			return "Pause", c.Pause(true)
+		case paused:
+			return "Play", c.Pause(false)
+		default:
+			return "Play", c.Play(-1)
+		}
+	},
+
+	"stop": func(c *mpd.Client, _ *model) (string, error) { return "Stop", c.Stop() },
+
+	"previous": func(c *mpd.Client, _ *model) (string, error) { return "Previous track", c.Previous() },
+
+	"next": func(c *mpd.Client, _ *model) (string, error) { return "Next track", c.Next() },
+
+	"volume-up": func(c *mpd.Client, m *model) (string, error) { return changeVolume(c, m, +volumeStep) },
+
+	"volume-down": func(c *mpd.Client, m *model) (string, error) { return changeVolume(c, m, -volumeStep) },
+
+	"seek-forward": func(c *mpd.Client, m *model) (string, error) { return seek(c, m, +seekStep) },
+
+	"seek-backward": func(c *mpd.Client, m *model) (string, error) { return seek(c, m, -seekStep) },
+}
+
+// screenActions maps the names used in the key map to what they do, for the
+// actions that screens perform in their handleKey methods instead of through
+// keyActions.
+var screenActions = map[string]string{
+	"menu":    "opens the menu",
+	"details": "switches the MPD screen to and from its details page",
+}
+
+// knownAction reports whether the key map can assign an action.
+func knownAction(a string) bool {
+	_, mpd := keyActions[a]
+	_, screen := screenActions[a]
+	return mpd || screen
+}
+
+// actionNames returns the names of every action the key map can assign, sorted
+// and quoted.
+func actionNames() []string {
+	var r []string
+	for a := range keyActions {
+		r = append(r, strconv.Quote(a))
+	}
+	for a := range screenActions {
+		r = append(r, strconv.Quote(a))
+	}
+	sort.Strings(r)
+	return r
+}
+
+// repeatable lists the actions that repeat while their key is held.
+var repeatable = map[string]bool{
+	"volume-up":     true,
+	"volume-down":   true,
+	"seek-forward":  true,
+	"seek-backward": true,
+}
+
+func changeVolume(c *mpd.Client, m *model, delta int) (string, error) {
+	if m.Volume < 0 {
+		return "No volume control", nil
+	}
+	v := m.Volume + delta
+	if v < 0 {
+		v = 0
+	} else if v > 100 {
+		v = 100
+	}
+	if err := c.SetVolume(v); err != nil {
+		return "", err
+	}
+	// The volume overlay shows the result. Update the model now so that
+	// it shows the new volume and repeated presses build on it.
+	m.Volume = v
+	m.showOverlay(volumeOverlay, m.LastKeyPress)
+	return "", nil
+}
+
+func seek(c *mpd.Client, m *model, d time.Duration) (string, error) {
+	if m.State == stopped || m.Duration <= 0 {
+		return "Nothing to seek", nil
+	}
+	if err := c.SeekCur(d, true); err != nil {
+		return "", err
+	}
+	if d < 0 {
+		return fmt.Sprintf("Back %v", -d), nil
+	}
+	return fmt.Sprintf("Forward %v", d), nil
+}
+
+// defaultKeyMap returns the key map used unless the configuration overrides
+// it.
+func defaultKeyMap() keyMap {
+	return keyMap{
+		"enter": "play-pause",
+		"left":  "previous",
+		"right": "next",
+		"up":    "volume-up",
+		"down":  "volume-down",
+		"exit":  "stop",
+
+		"long-left":  "seek-backward",
+		"long-right": "seek-forward",
+		"long-enter": "menu",
+		"long-exit":  "details",
+	}
+}
+
+// checkKeyName returns an error unless name can appear in a key map: a key
+// name alone for a short press, "long-" or "double-" and a key name for a long
+// or double press, or two different key names joined by "+" for a chord.
+func checkKeyName(name string) error {
+	if a, b, ok := strings.Cut(name, "+"); ok {
+		_, okA := keyNames[a]
+		_, okB := keyNames[b]
+		if okA && okB && a != b {
+			return nil
+		}
+	} else {
+		key := name
+		for _, prefix := range []string{"long-", "double-"} {
+			if strings.HasPrefix(name, prefix) {
+				key = strings.TrimPrefix(name, prefix)
+				break
+			}
+		}
+		if _, ok := keyNames[key]; ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key %q", name)
+}
+
+// keyName returns the name of k in key maps.
+func keyName(k cfa635.Key) string {
+	for name, key := range keyNames {
+		if key == k {
+			return name
+		}
+	}
+	return ""
+}
+
+// gestureOptions configures cfa635.Gestures for the key map. Only keys with a
+// double-press action can make double presses, so the other keys' short presses
+// aren't held back waiting for a second press.
+func gestureOptions() []cfa635.GestureOption {
+	var double []cfa635.Key
+	for name, k := range keyNames {
+		if _, ok := conf.Keys["double-"+name]; ok {
+			double = append(double, k)
+		}
+	}
+	return []cfa635.GestureOption{
+		cfa635.WithLongPress(time.Duration(conf.LongPress)),
+		cfa635.WithDoublePressKeys(double...),
+	}
+}
+
+// gestureAction returns the action that the key map assigns to a gesture.
+//
+// A double press falls back to the key's short-press action. Holding a key
+// performs its long-press action once, or repeatedly if the action is
+// repeatable; if the key has no long-press action but a repeatable short-press
+// action, holding the key repeats that instead.
+func gestureAction(e *cfa635.GestureEvent) string {
+	name := keyName(e.K)
+	switch e.Gesture {
+	case cfa635.ShortPress:
+		return conf.Keys[name]
+	case cfa635.DoublePress:
+		if a, ok := conf.Keys["double-"+name]; ok {
+			return a
+		}
+		return conf.Keys[name]
+	case cfa635.LongPress, cfa635.Repeat:
+		if a, ok := conf.Keys["long-"+name]; ok {
+			if e.Gesture == cfa635.LongPress || repeatable[a] {
+				return a
+			}
+			return ""
+		}
+		if a := conf.Keys[name]; repeatable[a] {
+			return a
+		}
+	case cfa635.Chord:
+		other := keyName(e.K2)
+		if a, ok := conf.Keys[name+"+"+other]; ok {
+			return a
+		}
+		return conf.Keys[other+"+"+name]
+	}
+	return ""
+}
+
+// handleKey performs the action that the key map assigns to a gesture that no
+// screen used, and records the key press in the model, which keeps the screen
+// lit and shows the result on the MPD screen.
+func handleKey(c *screenContext, e *cfa635.GestureEvent) {
+	action := gestureAction(e)
+	f, ok := keyActions[action]
+	if !ok || action == "none" {
+		return
+	}
+
+	c.model.LastKeyPress = e.Time
+	if !c.conn.connected() {
+		c.model.Feedback = "Not connected"
+		return
+	}
+	feedback, err := f(c.conn.client, c.model)
+	if err != nil {
+		// If the connection failed, the watcher will report it.
+		log.Printf("%s failed: %v", action, err)
+		feedback = "Failed"
+	}
+	c.model.Feedback = feedback
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+func TestCheckKeyName(t *testing.T) {
+	for _, name := range []string{"up", "long-enter", "double-exit", "left+right"} {
+		if err := checkKeyName(name); err != nil {
+			t.Errorf("checkKeyName(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range []string{"foo", "long-foo", "long-double-up", "double-long-up", "long-long-up", "up+up", "up+foo", "long-up+down"} {
+		err := checkKeyName(name)
+		if err == nil {
+			t.Errorf("checkKeyName(%q) succeeded", name)
+		} else if !strings.Contains(err.Error(), `"`+name+`"`) {
+			t.Errorf("checkKeyName(%q) = %v, want an error naming %q", name, err, name)
+		}
+	}
+}
+
+// actions presses keys through cfa635.Gestures, configured by gestureOptions,
+// and returns the actions that the key map assigns to the resulting gestures.
+func actions(presses ...cfa635.Key) []string {
+	keys := make(chan *cfa635.KeyActivity)
+	events := cfa635.Gestures(keys, gestureOptions()...)
+	for _, k := range presses {
+		keys <- &cfa635.KeyActivity{K: k, Pressed: true}
+		keys <- &cfa635.KeyActivity{K: k, Pressed: false}
+	}
+
+	var r []string
+	for {
+		select {
+		case e := <-events:
+			r = append(r, gestureAction(e))
+		case <-time.After(time.Second):
+			close(keys)
+			return r
+		}
+	}
+}
+
+func TestDoublePressAction(t *testing.T) {
+	old := conf
+	t.Cleanup(func() { conf = old })
+	conf = defaultConfig()
+	conf.Keys["double-enter"] = "next"
+
+	for _, tc := range []struct {
+		name    string
+		presses []cfa635.Key
+		want    string
+	}{
+		{"single", []cfa635.Key{cfa635.EnterButton}, "play-pause"},
+		{"double", []cfa635.Key{cfa635.EnterButton, cfa635.EnterButton}, "next"},
+		{"no double action", []cfa635.Key{cfa635.UpButton, cfa635.UpButton}, "volume-up,volume-up"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := strings.Join(actions(tc.presses...), ","); got != tc.want {
+				t.Errorf("actions = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,485 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/display"
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+const (
+	// menuTimeout is how long the menu stays open without a key press.
+	menuTimeout = 30 * time.Second
+
+	// The menu shows over everything else while it's open.
+	menuPriority = 40
+)
+
+// menuItem is an entry in a menu. Selecting it either opens a submenu or
+// performs an action.
+type menuItem struct {
+	label string
+	open  func(*mpd.Client) (*menu, error)
+	act   func(*mpd.Client) (string, error) // Returns a description of what it did
+}
+
+// menu is one level of the menu hierarchy.
+type menu struct {
+	title    string
+	load     func(*mpd.Client) ([]menuItem, error)
+	items    []menuItem
+	selected int
+	top      int // First item on the screen
+}
+
+// newMenu creates a menu and loads its items.
+func newMenu(c *mpd.Client, title string, load func(*mpd.Client) ([]menuItem, error)) (*menu, error) {
+	items, err := load(c)
+	if err != nil {
+		return nil, err
+	}
+	return &menu{title: title, load: load, items: items}, nil
+}
+
+// menuState is the menu screen: a stack of open menus, the innermost last.
+type menuState struct {
+	stack []*menu
+
+	LastMove     time.Time // When the selection last changed
+	Feedback     string    // What the last action did
+	LastFeedback time.Time
+}
+
+func init() { registerScreen("menu", new(menuState)) }
+
+// usesMPD reports that the menu needs MPD: its items browse and change MPD's
+// queue and settings.
+func (*menuState) usesMPD() bool { return true }
+
+// priority hides the menu while MPD is away and once nobody has used it for a
+// while. A gesture after the timeout closes it.
+func (s *menuState) priority(c *screenContext) (int, time.Time) {
+	if !s.active(c) {
+		return 0, time.Time{}
+	}
+	return menuPriority, c.model.LastKeyPress.Add(menuTimeout)
+}
+
+func (s *menuState) sprites(*screenContext) []*cfa635.Sprite {
+	return []*cfa635.Sprite{menuCursor}
+}
+
+// handleKey passes gestures to the open menu and opens the menu on the gesture
+// the key map assigns to it.
+func (s *menuState) handleKey(c *screenContext, e *cfa635.GestureEvent) bool {
+	if s.active(c) {
+		c.model.LastKeyPress = e.Time
+		s.handle(c.conn.client, e)
+		return true
+	}
+	s.close()
+
+	if gestureAction(e) != "menu" {
+		return false
+	}
+	c.model.LastKeyPress = e.Time
+	if !c.conn.connected() {
+		c.model.Feedback = "Not connected"
+		return true
+	}
+	if err := s.open(c.conn.client, e.Time); err != nil {
+		log.Print("failed to open menu: ", err)
+		c.model.Feedback = "Failed"
+	}
+	return true
+}
+
+func (s *menuState) isOpen() bool { return len(s.stack) > 0 }
+
+// active reports whether the menu is open and still usable: MPD is connected,
+// and the menu hasn't timed out.
+func (s *menuState) active(c *screenContext) bool {
+	return s.isOpen() && c.conn.connected() && c.now.Sub(c.model.LastKeyPress) < menuTimeout
+}
+
+// hidesOverlays keeps overlays off the menu, which needs every row.
+func (s *menuState) hidesOverlays() bool { return true }
+
+func (s *menuState) close() { s.stack = nil }
+
+func (s *menuState) current() *menu { return s.stack[len(s.stack)-1] }
+
+// open shows the top-level menu.
+func (s *menuState) open(c *mpd.Client, now time.Time) error {
+	m, err := newMenu(c, "Menu", rootMenu)
+	if err != nil {
+		return err
+	}
+	s.stack = []*menu{m}
+	s.LastMove = now
+	s.Feedback = ""
+	return nil
+}
+
+// handle responds to a gesture while the menu is open. Up and Down move the
+// selection, Enter and Right select, Left and Exit go back, and holding Exit
+// closes the menu.
+func (s *menuState) handle(c *mpd.Client, e *cfa635.GestureEvent) {
+	m := s.current()
+	switch {
+	case e.Gesture == cfa635.Chord:
+		return
+	case e.K == cfa635.ExitButton && e.Gesture == cfa635.LongPress:
+		s.close()
+	case e.K == cfa635.UpButton:
+		s.move(m, -1, e.Time)
+	case e.K == cfa635.DownButton:
+		s.move(m, +1, e.Time)
+	case e.Gesture == cfa635.LongPress || e.Gesture == cfa635.Repeat:
+		return
+	case e.K == cfa635.LeftButton || e.K == cfa635.ExitButton:
+		s.stack = s.stack[:len(s.stack)-1]
+	case e.K == cfa635.EnterButton || e.K == cfa635.RightButton:
+		if len(m.items) > 0 {
+			s.choose(c, m, &m.items[m.selected], e.Time)
+		}
+	}
+}
+
+func (s *menuState) move(m *menu, delta int, now time.Time) {
+	if len(m.items) == 0 {
+		return
+	}
+	m.selected = (m.selected + delta + len(m.items)) % len(m.items)
+	s.LastMove = now
+}
+
+// choose opens a submenu or performs an action. After an action, it reloads
+// the menu, whose labels may reflect the state the action changed.
+func (s *menuState) choose(c *mpd.Client, m *menu, item *menuItem, now time.Time) {
+	s.LastFeedback = now
+	s.LastMove = now
+	if item.open != nil {
+		sub, err := item.open(c)
+		if err != nil {
+			log.Printf("failed to open %s: %v", item.label, err)
+			s.Feedback = "Failed"
+			return
+		}
+		s.Feedback = ""
+		s.stack = append(s.stack, sub)
+		return
+	}
+
+	feedback, err := item.act(c)
+	if err != nil {
+		log.Printf("%s failed: %v", item.label, err)
+		feedback = "Failed"
+	}
+	s.Feedback = feedback
+	if items, err := m.load(c); err == nil {
+		m.items = items
+		if m.selected >= len(items) {
+			m.selected = len(items) - 1
+		}
+		if m.selected < 0 {
+			m.selected = 0
+		}
+	}
+}
+
+func rootMenu(*mpd.Client) ([]menuItem, error) {
+	return []menuItem{
+		{label: "Artists", open: func(c *mpd.Client) (*menu, error) { return newMenu(c, "Artists", artistsMenu) }},
+		{label: "Playlists", open: func(c *mpd.Client) (*menu, error) { return newMenu(c, "Playlists", playlistsMenu) }},
+		{label: "Queue", open: func(c *mpd.Client) (*menu, error) { return newMenu(c, "Queue", queueMenu) }},
+		{label: "Outputs", open: func(c *mpd.Client) (*menu, error) { return newMenu(c, "Outputs", outputsMenu) }},
+		{label: "Settings", open: func(c *mpd.Client) (*menu, error) { return newMenu(c, "Settings", settingsMenu) }},
+	}, nil
+}
+
+func artistsMenu(c *mpd.Client) ([]menuItem, error) {
+	artists, err := c.List("albumartist")
+	if err != nil {
+		return nil, err
+	}
+	var items []menuItem
+	for _, a := range artists {
+		if a == "" {
+			continue
+		}
+		a := a
+		items = append(items, menuItem{label: a, open: func(c *mpd.Client) (*menu, error) {
+			return newMenu(c, a, func(c *mpd.Client) ([]menuItem, error) { return albumsMenu(c, a) })
+		}})
+	}
+	return items, nil
+}
+
+func albumsMenu(c *mpd.Client, artist string) ([]menuItem, error) {
+	albums, err := c.List("album", "albumartist", artist)
+	if err != nil {
+		return nil, err
+	}
+	items := []menuItem{{label: "Play all", act: func(c *mpd.Client) (string, error) {
+		return replaceQueue(c, "albumartist", artist)
+	}}}
+	for _, al := range albums {
+		al := al
+		items = append(items, menuItem{label: al, open: func(c *mpd.Client) (*menu, error) {
+			return newMenu(c, al, func(c *mpd.Client) ([]menuItem, error) { return tracksMenu(c, artist, al) })
+		}})
+	}
+	return items, nil
+}
+
+func tracksMenu(c *mpd.Client, artist, album string) ([]menuItem, error) {
+	tracks, err := c.Find("albumartist", artist, "album", album)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(tracks, func(i, j int) bool { return trackNumber(tracks[i]) < trackNumber(tracks[j]) })
+	items := []menuItem{{label: "Play album", act: func(c *mpd.Client) (string, error) {
+		return replaceQueue(c, "albumartist", artist, "album", album)
+	}}}
+	for _, t := range tracks {
+		file, title := t["file"], t["Title"]
+		if title == "" {
+			title = file
+		}
+		items = append(items, menuItem{label: title, act: func(c *mpd.Client) (string, error) {
+			return "Added to queue", c.Add(file)
+		}})
+	}
+	return items, nil
+}
+
+// trackNumber parses the track number from song attributes like "3" or "3/12".
+func trackNumber(song mpd.Attrs) int {
+	t := song["Track"]
+	for i, r := range t {
+		if r < '0' || r > '9' {
+			t = t[:i]
+			break
+		}
+	}
+	n, _ := strconv.Atoi(t)
+	return n
+}
+
+// replaceQueue replaces the queue with the songs matching a find query and
+// starts playing them.
+func replaceQueue(c *mpd.Client, query ...string) (string, error) {
+	songs, err := c.Find(query...)
+	if err != nil {
+		return "", err
+	}
+	if len(songs) == 0 {
+		return "Nothing found", nil
+	}
+	sort.SliceStable(songs, func(i, j int) bool {
+		if songs[i]["Album"] != songs[j]["Album"] {
+			return songs[i]["Album"] < songs[j]["Album"]
+		}
+		return trackNumber(songs[i]) < trackNumber(songs[j])
+	})
+	if err := c.Clear(); err != nil {
+		return "", err
+	}
+	for _, s := range songs {
+		if err := c.Add(s["file"]); err != nil {
+			return "", err
+		}
+	}
+	return "Playing", c.Play(0)
+}
+
+func playlistsMenu(c *mpd.Client) ([]menuItem, error) {
+	playlists, err := c.ListPlaylists()
+	if err != nil {
+		return nil, err
+	}
+	var items []menuItem
+	for _, p := range playlists {
+		name := p["playlist"]
+		items = append(items, menuItem{label: name, act: func(c *mpd.Client) (string, error) {
+			if err := c.Clear(); err != nil {
+				return "", err
+			}
+			if err := c.PlaylistLoad(name, -1, -1); err != nil {
+				return "", err
+			}
+			return "Playing", c.Play(0)
+		}})
+	}
+	return items, nil
+}
+
+func queueMenu(c *mpd.Client) ([]menuItem, error) {
+	songs, err := c.PlaylistInfo(-1, -1)
+	if err != nil {
+		return nil, err
+	}
+	var items []menuItem
+	for i, s := range songs {
+		i, label := i, s["Title"]
+		if label == "" {
+			label = s["file"]
+		}
+		items = append(items, menuItem{label: label, act: func(c *mpd.Client) (string, error) {
+			return "Playing", c.Play(i)
+		}})
+	}
+	return items, nil
+}
+
+func outputsMenu(c *mpd.Client) ([]menuItem, error) {
+	outputs, err := c.ListOutputs()
+	if err != nil {
+		return nil, err
+	}
+	var items []menuItem
+	for _, o := range outputs {
+		id, err := strconv.Atoi(o["outputid"])
+		if err != nil {
+			return nil, err
+		}
+		name, enabled := o["outputname"], o["outputenabled"] == "1"
+		items = append(items, menuItem{label: checkbox(enabled) + name, act: func(c *mpd.Client) (string, error) {
+			if enabled {
+				return "Disabled " + name, c.DisableOutput(id)
+			}
+			return "Enabled " + name, c.EnableOutput(id)
+		}})
+	}
+	return items, nil
+}
+
+func settingsMenu(c *mpd.Client) ([]menuItem, error) {
+	status, err := c.Status()
+	if err != nil {
+		return nil, err
+	}
+	toggle := func(label, key string, set func(*mpd.Client, bool) error) menuItem {
+		on := status[key] == "1"
+		return menuItem{label: checkbox(on) + label, act: func(c *mpd.Client) (string, error) {
+			return fmt.Sprintf("%s %s", label, onOff(!on)), set(c, !on)
+		}}
+	}
+	return []menuItem{
+		toggle("Random", "random", (*mpd.Client).Random),
+		toggle("Repeat", "repeat", (*mpd.Client).Repeat),
+		toggle("Single", "single", (*mpd.Client).Single),
+		toggle("Consume", "consume", (*mpd.Client).Consume),
+	}, nil
+}
+
+func checkbox(on bool) string {
+	if on {
+		return "● "
+	}
+	return "◦ "
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// render draws the open menu: its title, or the result of the last action,
+// in the first row, and its items below, with the selected item marked and
+// scrolling if it's too long to fit. Arrows in the last column show that there
+// are more items above or below.
+func (s *menuState) render(c *screenContext, old *view) *view {
+	model, now, glyphs, cols, rows := c.model, c.now, c.glyphs, c.cols, c.rows
+
+	var new view
+	new.LCD = display.NewFrame(cols, rows)
+	m := s.current()
+
+	title := m.title
+	if until := s.LastFeedback.Add(feedbackDuration); s.Feedback != "" && now.Before(until) {
+		title = s.Feedback
+		new.Next = until
+	}
+	first := 0
+	if rows > 1 {
+		ellipsize(glyphs.Encode(title), ellipsis(glyphs), new.LCD[0])
+		first = 1
+	}
+
+	// Keep the selection on screen.
+	visible := rows - first
+	if m.selected < m.top {
+		m.top = m.selected
+	} else if m.selected >= m.top+visible {
+		m.top = m.selected - visible + 1
+	}
+
+	cursor := sprite(glyphs, menuCursor, 0x10) // ▶
+	for i := 0; i < visible && m.top+i < len(m.items); i++ {
+		row := new.LCD[first+i]
+		label := glyphs.Encode(m.items[m.top+i].label)
+		if m.top+i == m.selected {
+			row[0] = cursor
+			copy(row[1:cols-1], rotate(label, cols-2, s.LastMove, now))
+			new.Next = earliest(new.Next, rotateNext(label, cols-2, s.LastMove, now))
+		} else {
+			ellipsize(label, ellipsis(glyphs), row[1:cols-1])
+		}
+	}
+	if len(m.items) == 0 && visible > 0 {
+		copy(new.LCD[first][1:], encode("(empty)"))
+	}
+	if m.top > 0 {
+		new.LCD[first][cols-1] = 0x1a // ▲
+	}
+	if m.top+visible < len(m.items) {
+		new.LCD[rows-1][cols-1] = 0x1b // ▼
+	}
+
+	new.DisplayBrightness = setBrightness(model, now, old)
+	new.Next = earliest(new.Next, brightnessNext(model, now, new.DisplayBrightness))
+	new.Mtime = now
+	return &new
+}
+
+// ellipsis returns the character that marks truncated text.
+func ellipsis(glyphs *cfa635.GlyphManager) byte {
+	if e := glyphs.Encode("…"); len(e) == 1 {
+		return e[0]
+	}
+	return '~'
+}
+
+var menuCursor = cfa635.MustParseSprite(`
+	......
+	.#....
+	.##...
+	.###..
+	.####.
+	.###..
+	.##...
+	.#....
+`)
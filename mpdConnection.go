@@ -0,0 +1,109 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/fhs/gompd/v2/mpd"
+)
+
+const (
+	minMPDBackoff = 250 * time.Millisecond
+	maxMPDBackoff = 10 * time.Second
+)
+
+// mpdConnection holds a command connection and an idle notification connection
+// to MPD, reopening them with exponential backoff after they fail.
+type mpdConnection struct {
+	network, addr, password string
+
+	client  *mpd.Client  // nil while disconnected
+	watcher *mpd.Watcher // nil while disconnected
+
+	backoff time.Duration // Delay before the next reconnection attempt
+	retryAt time.Time     // When to try to reconnect, while disconnected
+}
+
+func newMPDConnection(network, addr, password string) *mpdConnection {
+	return &mpdConnection{network: network, addr: addr, password: password, backoff: minMPDBackoff}
+}
+
+func (c *mpdConnection) connected() bool { return c.client != nil }
+
+// connect tries to connect to MPD if the connection is down and it's time to
+// try again. It reports whether it connected.
+func (c *mpdConnection) connect(now time.Time) bool {
+	if c.connected() || now.Before(c.retryAt) {
+		return false
+	}
+
+	watcher, err := mpd.NewWatcher(c.network, c.addr, c.password, "player", "mixer", "options", "playlist")
+	if err == nil {
+		var client *mpd.Client
+		if client, err = mpd.DialAuthenticated(c.network, c.addr, c.password); err == nil {
+			c.client, c.watcher = client, watcher
+			c.backoff = minMPDBackoff
+			return true
+		}
+		watcher.Close()
+	}
+
+	log.Print("failed to connect to MPD: ", err)
+	c.retryAfter(now)
+	return false
+}
+
+// drop closes the connection after a failure and schedules a reconnection.
+func (c *mpdConnection) drop(now time.Time, err error) {
+	log.Print("lost connection to MPD: ", err)
+	c.close()
+	c.retryAfter(now)
+}
+
+func (c *mpdConnection) retryAfter(now time.Time) {
+	c.retryAt = now.Add(c.backoff)
+	c.backoff *= 2
+	if c.backoff > maxMPDBackoff {
+		c.backoff = maxMPDBackoff
+	}
+}
+
+// events returns the channel of changed MPD subsystems, or nil while
+// disconnected.
+func (c *mpdConnection) events() <-chan string {
+	if c.watcher == nil {
+		return nil
+	}
+	return c.watcher.Event
+}
+
+// errors returns the channel of idle notification errors, or nil while
+// disconnected.
+func (c *mpdConnection) errors() <-chan error {
+	if c.watcher == nil {
+		return nil
+	}
+	return c.watcher.Error
+}
+
+func (c *mpdConnection) close() {
+	if c.client != nil {
+		c.client.Close()
+		c.watcher.Close()
+	}
+	c.client, c.watcher = nil, nil
+}
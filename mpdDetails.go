@@ -0,0 +1,151 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/display"
+)
+
+// The details page of the MPD screen explains why playback behaves the way it
+// does:
+//
+// 	Next: Song 2       ⤨▶
+// 	Song 3 of 12  320kbps
+// 	44.1kHz 16bit stereo
+// 	Random, repeat
+//
+// The first row shows the song that plays next, the middle rows the position in
+// the queue, bitrate, and audio format, and the last row MPD's error, if any, a
+// database update in progress, or the playback modes that are on.
+
+// setDetails fills all rows but the last with the details page, dropping the
+// audio format and then the queue position on short displays. The first row
+// stops short of the icons, which take the last icons columns. It returns when
+// the rows next scroll, or the zero time if they all fit.
+func setDetails(model *model, since, now time.Time, glyphs *cfa635.GlyphManager, lcdState display.Frame, icons int) time.Time {
+	cols, rows := lcdState.Size()
+	var next time.Time
+	set := func(row int, s string, width int) {
+		b := glyphs.Encode(s)
+		copy(lcdState[row][:], rotate(b, width, since, now))
+		next = earliest(next, rotateNext(b, width, since, now))
+	}
+
+	switch {
+	case model.NextSongID == "":
+		set(0, "Nothing next", cols-icons)
+	case model.NextTrack == "":
+		set(0, "Next: untitled", cols-icons)
+	default:
+		set(0, "Next: "+model.NextTrack, cols-icons)
+	}
+	if rows > 2 {
+		var queue string
+		if model.Position >= 0 {
+			queue = fmt.Sprintf("Song %d of %d", model.Position+1, model.QueueLength)
+		} else {
+			queue = fmt.Sprintf("%d songs queued", model.QueueLength)
+		}
+		if model.Bitrate > 0 {
+			bitrate := fmt.Sprintf("%dkbps", model.Bitrate)
+			pad := cols - len(queue) - len(bitrate)
+			if pad < 1 {
+				pad = 1
+			}
+			queue += strings.Repeat(" ", pad) + bitrate
+		}
+		set(1, queue, cols)
+	}
+	if rows > 3 {
+		set(2, fmtAudioFormat(model.AudioFormat), cols)
+	}
+	return next
+}
+
+// setDetailsStatus fills the last row with MPD's error, if any, or a note that
+// MPD is updating its database, or the playback modes that are on. It returns
+// when the row next scrolls, or the zero time if it fits.
+func setDetailsStatus(model *model, since, now time.Time, glyphs *cfa635.GlyphManager, lcdState display.Frame) time.Time {
+	var status string
+	switch {
+	case model.Error != "":
+		status = "Error: " + model.Error
+	case model.UpdatingDB:
+		status = "Updating database"
+	default:
+		var modes []string
+		for _, m := range []struct {
+			on   bool
+			name string
+		}{
+			{model.Random, "random"},
+			{model.Repeat, "repeat"},
+			{model.Single, "single"},
+			{model.Consume, "consume"},
+		} {
+			if m.on {
+				modes = append(modes, m.name)
+			}
+		}
+		if len(modes) > 0 {
+			status = strings.Join(modes, ", ")
+			status = strings.ToUpper(status[:1]) + status[1:]
+		}
+	}
+
+	row := lcdState[len(lcdState)-1]
+	b := glyphs.Encode(status)
+	copy(row, rotate(b, len(row), since, now))
+	return rotateNext(b, len(row), since, now)
+}
+
+// fmtAudioFormat describes an audio format given in MPD's
+// samplerate:bits:channels notation, like "44.1kHz 16bit stereo". It returns
+// formats it doesn't understand, like DSD, unchanged.
+func fmtAudioFormat(f string) string {
+	parts := strings.Split(f, ":")
+	if len(parts) != 3 {
+		return f
+	}
+	rate, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return f
+	}
+
+	desc := []string{strconv.FormatFloat(float64(rate)/1000, 'f', -1, 64) + "kHz"}
+	switch parts[1] {
+	case "f":
+		desc = append(desc, "float")
+	case "*":
+	default:
+		desc = append(desc, parts[1]+"bit")
+	}
+	switch parts[2] {
+	case "1":
+		desc = append(desc, "mono")
+	case "2":
+		desc = append(desc, "stereo")
+	case "*":
+	default:
+		desc = append(desc, parts[2]+"ch")
+	}
+	return strings.Join(desc, " ")
+}
@@ -21,10 +21,11 @@ import (
 	"golang.org/x/text/transform"
 
 	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/display"
 )
 
 var (
-	encoder = cfa635.NewEncoder()
+	encoder = cfa635.NewTransliterator()
 )
 
 func encode(s string) []byte {
@@ -35,26 +36,76 @@ func encode(s string) []byte {
 	return []byte(r)
 }
 
-func setPlaybackIcon(model *model, lcdState *cfa635.LCDState) {
+// sprite returns the character that displays bitmap, or fallback if there's no
+// CGRAM slot left for it.
+func sprite(glyphs *cfa635.GlyphManager, bitmap *cfa635.Sprite, fallback byte) byte {
+	c, ok := glyphs.Sprite(bitmap)
+	if !ok {
+		return fallback
+	}
+	return c
+}
+
+func setPlaybackIcon(model *model, glyphs *cfa635.GlyphManager, lcdState display.Frame) {
+	icon := &lcdState[0][len(lcdState[0])-1]
 	switch model.State {
 	case stopped:
-		lcdState[0][19] = 0xd0
+		*icon = 0xd0
 	case playing:
-		lcdState[0][19] = 0x10
+		*icon = 0x10
 	case paused:
-		lcdState[0][19] = pauseIconSprite
+		*icon = sprite(glyphs, pauseIcon, 0xfe) // |
 	}
 }
 
+// setStatusIcons draws icons for MPD's random, repeat, single, and consume
+// modes, and for a database update or error, to the left of the playback icon.
+// It returns how many columns the icons take, including the playback icon.
+func setStatusIcons(model *model, glyphs *cfa635.GlyphManager, lcdState display.Frame) int {
+	var icons []byte
+	if model.Random {
+		icons = append(icons, sprite(glyphs, randomIcon, 'S'))
+	}
+	if model.Repeat {
+		icons = append(icons, sprite(glyphs, repeatIcon, 'R'))
+	}
+	if model.Single {
+		icons = append(icons, '1')
+	}
+	if model.Consume {
+		icons = append(icons, 'C')
+	}
+	if model.UpdatingDB {
+		icons = append(icons, '*')
+	}
+	if model.Error != "" {
+		icons = append(icons, '!')
+	}
+
+	// Leave at least half the row for the track.
+	row := lcdState[0]
+	if max := len(row)/2 - 1; len(icons) > max {
+		icons = icons[len(icons)-max:]
+	}
+	copy(row[len(row)-1-len(icons):], icons)
+	return len(icons) + 1
+}
+
+// Rotation timing: text that doesn't fit moves one character per tick, pausing
+// for rotationDelay ticks at the start.
+const (
+	rotationTick  = 333 * time.Millisecond
+	rotationDelay = 10
+)
+
 func rotate(s []byte, width int, start, now time.Time) []byte {
-	const delay int = 10
-	const rotationRate float64 = 1 / float64(333*time.Millisecond)
+	const delay int = rotationDelay
 
 	if len(s) <= width {
 		return s
 	}
 
-	ticks := int(float64(now.Sub(start).Nanoseconds()) * rotationRate)
+	ticks := int(now.Sub(start) / rotationTick)
 
 	if len(s) < 2*width {
 		// Just scroll back and forth.
@@ -88,35 +139,69 @@ func rotate(s []byte, width int, start, now time.Time) []byte {
 	return append(s[i:], s[:i]...)[:width]
 }
 
-func setTrackInfo(model *model, now time.Time, lcdState *cfa635.LCDState) {
-	// Cut off the track one character short so we don't overwrite the
-	// playback icon.
-	copy(lcdState[0][:], rotate(encode(model.Track), 19, model.LastTrackInfoUpdate, now))
-	copy(lcdState[1][:], rotate(encode(model.Artist), 20, model.LastTrackInfoUpdate, now))
-	copy(lcdState[2][:], rotate(encode(model.Album), 20, model.LastTrackInfoUpdate, now))
+// rotateNext returns the time of the next rotation tick if s doesn't fit in
+// width, or the zero time if it does and so never moves.
+func rotateNext(s []byte, width int, start, now time.Time) time.Time {
+	if len(s) <= width {
+		return time.Time{}
+	}
+	ticks := now.Sub(start) / rotationTick
+	return start.Add((ticks + 1) * rotationTick)
+}
+
+// setTrackInfo fills all rows but the last with the track, artist, and album,
+// in that order, dropping the album and then the artist on short displays. The
+// track stops short of the icons, which take the last icons columns of the first
+// row. It returns when the rows next scroll, or the zero time if they all fit.
+func setTrackInfo(model *model, now time.Time, glyphs *cfa635.GlyphManager, lcdState display.Frame, icons int) time.Time {
+	cols, rows := lcdState.Size()
+	var next time.Time
+	set := func(row int, s string, width int) {
+		b := glyphs.Encode(s)
+		copy(lcdState[row][:], rotate(b, width, model.LastTrackInfoUpdate, now))
+		next = earliest(next, rotateNext(b, width, model.LastTrackInfoUpdate, now))
+	}
+	set(0, model.Track, cols-icons)
+	if rows > 2 {
+		set(1, model.Artist, cols)
+	}
+	if rows > 3 {
+		set(2, model.Album, cols)
+	}
+	return next
 }
 
-func setTimeElapsed(model *model, lcdState *cfa635.LCDState) int {
+func setTimeElapsed(model *model, lcdState display.Frame) int {
 	elapsed := fmtTime(model.Elapsed, model.Duration)
-	copy(lcdState[3][:], elapsed)
+	copy(lcdState[len(lcdState)-1][:], elapsed)
 	return len(elapsed)
 }
 
-func setTimeRemaining(model *model, lcdState *cfa635.LCDState) int {
+func setTimeRemaining(model *model, lcdState display.Frame) int {
 	remaining := fmtTime(model.Elapsed-model.Duration, model.Duration)
-	copy(lcdState[3][20-len(remaining):], remaining)
+	row := lcdState[len(lcdState)-1]
+	copy(row[len(row)-len(remaining):], remaining)
 	return len(remaining)
 }
 
-func setProgressBar(model *model, barStart, barEnd int, lcdState *cfa635.LCDState) {
+func setProgressBar(model *model, barStart, barEnd int, glyphs *cfa635.GlyphManager, lcdState display.Frame) {
 	fraction := float64(model.Elapsed) / float64(model.Duration)
+	drawBar(lcdState[len(lcdState)-1][barStart:barEnd], fraction, glyphs)
+}
+
+// drawBar fills row with a horizontal bar, colored in from the left in
+// proportion to fraction.
+func drawBar(row []byte, fraction float64, glyphs *cfa635.GlyphManager) {
+	if fraction > 1 {
+		fraction = 1
+	}
 
-	// Convert the fraction played to the number of columns that should be
+	// Convert the fraction to the number of columns that should be
 	// colored in the bar. Each cell has 6 columns; leave one extra column
-	// free at the left of the bar so it doesn't crash into the time
-	// elapsed.
-	c := int(math.Round(fraction * (6*float64(barEnd-barStart) - 1)))
-	if c == 0 {
+	// free at the left of the bar so it doesn't crash into whatever is to
+	// its left.
+	c := int(math.Round(fraction * (6*float64(len(row)) - 1)))
+	if c <= 0 {
 		return
 	}
 
@@ -126,122 +211,247 @@ func setProgressBar(model *model, barStart, barEnd int, lcdState *cfa635.LCDStat
 	if w > 5 {
 		w = 5
 	}
-	lcdState[3][barStart] = byte(0xdb - w)
+	row[0] = byte(0xdb - w)
 	c -= w
 	if c == 0 {
 		return
 	}
 
 	// Fill in the full cells in the bar.
-	x := barStart + 1
-	for ; c >= 6; x, c = x+1, c-6 {
-		lcdState[3][x] = progressBarSpriteFull
+	x := 1
+	if c >= 6 {
+		full := progressBar(6)
+		b := sprite(glyphs, &full, 0xd6)
+		for ; c >= 6; x, c = x+1, c-6 {
+			row[x] = b
+		}
 	}
 	if c == 0 {
 		return
 	}
 
 	// Fill in the last, partial bar.
-	lcdState[3][x] = byte(progressBarSprite1 - 1 + c)
+	partial := progressBar(c)
+	row[x] = sprite(glyphs, &partial, byte(0xdb-c))
 }
 
-const (
-	ellipsisSprite = iota
-	pauseIconSprite
-	progressBarSprite1
-	progressBarSprite2
-	progressBarSprite3
-	progressBarSprite4
-	progressBarSprite5
-	progressBarSpriteFull
-)
+// feedbackDuration is how long the MPD screen shows what a key press did.
+const feedbackDuration = 2 * time.Second
 
-func initializeMPDDisplay(lcd *cfa635.Module) error {
-	// Load sprites.
-
-	if err := lcd.SetCharacter(ellipsisSprite, &[...]byte{
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_000000,
-		0b00_010101,
-		0b00_000000,
-	}); err != nil {
-		return err
-	}
-
-	if err := lcd.SetCharacter(pauseIconSprite, &[...]byte{
-		0b00_000000,
-		0b00_011011,
-		0b00_011011,
-		0b00_011011,
-		0b00_011011,
-		0b00_011011,
-		0b00_000000,
-		0b00_000000,
-	}); err != nil {
-		return err
-	}
-
-	for w := 1; w <= 6; w++ {
-		r := byte((1<<w - 1) << (6 - w))
-		if err := lcd.SetCharacter(progressBarSprite1-1+w, &[...]byte{
-			r,
-			r,
-			r,
-			r,
-			r,
-			r,
-			r,
-			0b00_000000,
-		}); err != nil {
-			return err
-		}
+// setFeedback centers the result of the last key press in the last row, in
+// place of the times and progress bar.
+func setFeedback(model *model, glyphs *cfa635.GlyphManager, lcdState display.Frame) {
+	row := lcdState[len(lcdState)-1]
+	f := glyphs.Encode(model.Feedback)
+	if len(f) > len(row) {
+		f = f[:len(row)]
 	}
+	copy(row[(len(row)-len(f))/2:], f)
+}
+
+// progressBar returns a sprite for a progress bar cell with w columns (between
+// 1 and 6, inclusive) colored in.
+func progressBar(w int) cfa635.Sprite {
+	return progressBarFull.Shift(w-cfa635.SpriteWidth, 0)
+}
 
-	return nil
+var progressBarFull = cfa635.MustParseSprite(`
+	######
+	######
+	######
+	######
+	######
+	######
+	######
+	......
+`)
+
+var randomIcon = cfa635.MustParseSprite(`
+	......
+	##...#
+	..#.#.
+	...#..
+	..#.#.
+	##...#
+	......
+	......
+`)
+
+var repeatIcon = cfa635.MustParseSprite(`
+	..#...
+	.####.
+	#.#..#
+	#....#
+	#..#.#
+	.####.
+	...#..
+	......
+`)
+
+var pauseIcon = cfa635.MustParseSprite(`
+	......
+	.##.##
+	.##.##
+	.##.##
+	.##.##
+	.##.##
+	......
+	......
+`)
+
+// brightnessTick returns how long the backlight takes to ramp one percent.
+func brightnessTick() time.Duration {
+	return time.Duration(float64(time.Second) / conf.RampRate)
 }
 
 func brightnessStep(pm float64, then, now time.Time, old float64) float64 {
-	const brightnessRampRate float64 = 20.0 / float64(500*time.Millisecond)
+	brightnessRampRate := 1 / float64(brightnessTick())
 
 	dt := float64(now.Sub(then).Nanoseconds())
 	return old + pm*dt*brightnessRampRate
 }
 
+// lit reports whether the backlight should be at full brightness.
+func lit(model *model, now time.Time) bool {
+	return model.State == playing || now.Sub(model.lastActivity()) < time.Duration(conf.DimAfter)
+}
+
 func setBrightness(model *model, now time.Time, old *view) float64 {
 	var z time.Time
 	if old.Mtime == z {
 		return old.DisplayBrightness
 	}
 
-	if model.State == playing || now.Sub(model.LastStateChange).Seconds() < 15 {
-		if old.DisplayBrightness >= 20 {
-			return 20
+	bright, dim := float64(conf.Brightness), float64(conf.IdleBrightness)
+	if lit(model, now) {
+		if old.DisplayBrightness >= bright {
+			return bright
 		}
-		return brightnessStep(+1, old.Mtime, now, old.DisplayBrightness)
+		return math.Min(bright, brightnessStep(+1, old.Mtime, now, old.DisplayBrightness))
 	} else {
-		if old.DisplayBrightness == 0 {
-			return 0
+		if old.DisplayBrightness <= dim {
+			return dim
 		}
-		return math.Max(0, brightnessStep(-1, old.Mtime, now, old.DisplayBrightness))
+		return math.Max(dim, brightnessStep(-1, old.Mtime, now, old.DisplayBrightness))
+	}
+}
+
+// brightnessNext returns when setBrightness will next change the brightness,
+// or the zero time if it won't until the model changes.
+func brightnessNext(model *model, now time.Time, brightness float64) time.Time {
+	lit := lit(model, now)
+	switch {
+	case lit && brightness != float64(conf.Brightness), !lit && brightness != float64(conf.IdleBrightness):
+		return now.Add(brightnessTick())
+	case lit && model.State != playing:
+		return model.lastActivity().Add(time.Duration(conf.DimAfter))
+	}
+	return time.Time{}
+}
+
+// elapsedNext returns when the time elapsed, the time remaining, or the
+// progress bar will next change, or the zero time if playback isn't advancing.
+func elapsedNext(model *model, barWidth int, now time.Time) time.Time {
+	if model.State != playing || model.Duration <= 0 {
+		return time.Time{}
+	}
+	step := time.Second - model.Elapsed%time.Second
+	if n := 6*barWidth - 1; n > 0 && model.Duration/time.Duration(n) < step {
+		step = model.Duration / time.Duration(n)
 	}
+	return now.Add(step)
 }
 
-func mpdView(model *model, now time.Time, old *view) *view {
+// The MPD screen shows what's playing while MPD plays and for a while after
+// playback stops, and whenever there's nothing else to show.
+const (
+	mpdPriority     = 20
+	mpdIdlePriority = 5
+)
+
+type mpdScreen struct {
+	details      bool      // Whether the details page is showing
+	detailsSince time.Time // When the details page last came up
+}
+
+func init() { registerScreen("mpd", new(mpdScreen)) }
+
+func (*mpdScreen) priority(c *screenContext) (int, time.Time) {
+	if !c.conn.connected() {
+		return 0, time.Time{}
+	}
+	if c.model.State == playing {
+		return mpdPriority, time.Time{}
+	}
+	if until := c.model.lastActivity().Add(time.Duration(conf.ClockAfter)); c.now.Before(until) {
+		return mpdPriority, until
+	}
+	return mpdIdlePriority, time.Time{}
+}
+
+func (*mpdScreen) usesMPD() bool { return true }
+
+// sprites returns the icons for the playback state and modes.
+func (*mpdScreen) sprites(c *screenContext) []*cfa635.Sprite {
+	var r []*cfa635.Sprite
+	if c.model.State == paused {
+		r = append(r, pauseIcon)
+	}
+	if c.model.Random {
+		r = append(r, randomIcon)
+	}
+	if c.model.Repeat {
+		r = append(r, repeatIcon)
+	}
+	return r
+}
+
+// handleKey switches between the main page and the details page on the gesture
+// that the key map assigns to "details".
+func (s *mpdScreen) handleKey(c *screenContext, e *cfa635.GestureEvent) bool {
+	if gestureAction(e) != "details" {
+		return false
+	}
+	c.model.LastKeyPress = e.Time
+	s.details = !s.details
+	s.detailsSince = e.Time
+	return true
+}
+
+// render draws the MPD screen's main page, or its details page if it's showing,
+// requesting the sprites it needs from c.glyphs. The icons take precedence over
+// any characters in the track info that need sprites.
+func (s *mpdScreen) render(c *screenContext, old *view) *view {
+	now, glyphs, cols, rows := c.now, c.glyphs, c.cols, c.rows
+
+	// Draw the time elapsed as of now, not as of MPD's last report.
+	m := *c.model
+	m.Elapsed = m.elapsedAt(now)
+	model := &m
+
 	var new view
-	new.LCD = cfa635.ClearedLCDState()
-	setPlaybackIcon(model, new.LCD)
-	setTrackInfo(model, now, new.LCD)
-	if model.Duration > 0 {
+	new.LCD = display.NewFrame(cols, rows)
+	setPlaybackIcon(model, glyphs, new.LCD)
+	icons := setStatusIcons(model, glyphs, new.LCD)
+	if until := model.LastKeyPress.Add(feedbackDuration); model.Feedback != "" && now.Before(until) {
+		setFeedback(model, glyphs, new.LCD)
+		new.Next = until
+	} else if s.details {
+		new.Next = setDetailsStatus(model, s.detailsSince, now, glyphs, new.LCD)
+	} else if model.Duration > 0 {
 		barStart := setTimeElapsed(model, new.LCD)
-		barEnd := 20 - setTimeRemaining(model, new.LCD)
-		setProgressBar(model, barStart, barEnd, new.LCD)
+		barEnd := cols - setTimeRemaining(model, new.LCD)
+		setProgressBar(model, barStart, barEnd, glyphs, new.LCD)
+		new.Next = elapsedNext(model, barEnd-barStart, now)
+	}
+	if s.details {
+		new.Next = earliest(new.Next, setDetails(model, s.detailsSince, now, glyphs, new.LCD, icons))
+	} else {
+		new.Next = earliest(new.Next, setTrackInfo(model, now, glyphs, new.LCD, icons))
 	}
 
 	new.DisplayBrightness = setBrightness(model, now, old)
+	new.Next = earliest(new.Next, brightnessNext(model, now, new.DisplayBrightness))
 
 	new.Mtime = now
 
@@ -0,0 +1,166 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/display"
+)
+
+// overlayKind identifies what an overlay shows.
+type overlayKind byte
+
+const (
+	noOverlay overlayKind = iota
+	volumeOverlay
+	seekOverlay
+	randomOverlay
+	repeatOverlay
+)
+
+// seekTolerance is how far the time elapsed that MPD reports can stray from
+// the extrapolated time elapsed before audiotrond decides the track was
+// seeked.
+const seekTolerance = 2 * time.Second
+
+// overlayFade is the fraction of the overlay duration over which the overlay
+// fades out at the end. The display can't dim part of the screen, so the
+// overlay fades by wiping away to the left, uncovering the screen underneath a
+// column at a time.
+const overlayFade = 0.25
+
+// An overlayHider is a screen that overlays shouldn't cover, because it
+// shows the same information or needs rows 1 and 2 itself.
+type overlayHider interface {
+	hidesOverlays() bool
+}
+
+// showOverlay shows an overlay for the given setting, starting at now.
+func (m *model) showOverlay(k overlayKind, now time.Time) {
+	m.Overlay = k
+	m.LastOverlay = now
+}
+
+// noticeChanges shows an overlay if the volume, random or repeat mode, or
+// position in the current track differ from prev, the model as it was before
+// polling MPD. It doesn't show one after the first poll, when there's nothing
+// to compare against, or when a track that played to its end starts over,
+// which MPD does without changing the song ID when single and repeat are on.
+func (m *model) noticeChanges(prev *model, now time.Time) {
+	if prev.LastElapsedUpdate.IsZero() {
+		return
+	}
+	switch {
+	case m.Volume != prev.Volume && m.Volume >= 0 && prev.Volume >= 0:
+		m.showOverlay(volumeOverlay, now)
+	case m.Random != prev.Random:
+		m.showOverlay(randomOverlay, now)
+	case m.Repeat != prev.Repeat:
+		m.showOverlay(repeatOverlay, now)
+	case m.SongID == prev.SongID && m.Duration > 0 && m.State != stopped:
+		want := prev.elapsedAt(now)
+		if prev.State == playing && m.Elapsed < want-seekTolerance {
+			over := prev.Elapsed + now.Sub(prev.LastElapsedUpdate) - prev.Duration
+			if over > -seekTolerance {
+				// The track ran out and started over.
+				want = 0
+				if over > 0 {
+					want = over
+				}
+			}
+		}
+		d := m.Elapsed - want
+		if d > seekTolerance || d < -seekTolerance {
+			m.showOverlay(seekOverlay, now)
+		}
+	}
+}
+
+// drawOverlay draws the overlay that the model calls for, if any, over rows 1
+// and 2 of v, unless fg hides overlays. The screen underneath redraws itself
+// from scratch for every frame, so as the overlay fades and once it goes away,
+// only the cells it covered change.
+func drawOverlay(c *screenContext, fg screen, v *view) {
+	m := c.model
+	until := m.LastOverlay.Add(time.Duration(conf.OverlayDuration))
+	if m.Overlay == noOverlay || !c.now.Before(until) {
+		return
+	}
+	if h, ok := fg.(overlayHider); ok && h.hidesOverlays() {
+		return
+	}
+	v.Next = earliest(v.Next, until)
+
+	// Over the fade, the overlay's width shrinks from c.cols to 1 in equal
+	// steps. It's w columns wide while the time remaining is in
+	// (fade*(w-1)/cols, fade*w/cols].
+	width := c.cols
+	fade := time.Duration(float64(conf.OverlayDuration) * overlayFade)
+	if left := until.Sub(c.now); left < fade {
+		cols := time.Duration(c.cols)
+		width = int((cols*left + fade - 1) / fade)
+		v.Next = earliest(v.Next, until.Add(-fade*time.Duration(width-1)/cols))
+	} else {
+		v.Next = earliest(v.Next, until.Add(-fade))
+	}
+
+	var (
+		label, value string
+		fraction     = -1.0 // No bar
+	)
+	switch m.Overlay {
+	case volumeOverlay:
+		label = "Volume"
+		value = fmt.Sprintf("%d%%", m.Volume)
+		fraction = float64(m.Volume) / 100
+	case seekOverlay:
+		e := *m
+		e.Elapsed = m.elapsedAt(c.now)
+		label = "Position"
+		value = fmtTime(e.Elapsed, e.Duration) + "/" + fmtTime(e.Duration, e.Duration)
+		if e.Duration > 0 {
+			fraction = float64(e.Elapsed) / float64(e.Duration)
+		}
+		v.Next = earliest(v.Next, elapsedNext(&e, c.cols, c.now))
+	case randomOverlay:
+		label = "Random"
+		value = onOff(m.Random)
+	case repeatOverlay:
+		label = "Repeat"
+		value = onOff(m.Repeat)
+	}
+
+	o := display.NewFrame(c.cols, 2)
+	copy(o[0], c.glyphs.Encode(label))
+	val := c.glyphs.Encode(value)
+	if len(val) < len(o[0]) {
+		copy(o[0][len(o[0])-len(val):], val)
+	}
+	if fraction >= 0 {
+		drawBar(o[1], fraction, c.glyphs)
+	}
+
+	top := 1
+	if c.rows < 3 {
+		top = 0
+	}
+	for y := range o {
+		if top+y < c.rows {
+			copy(v.LCD[top+y], o[y][:width])
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/display"
+)
+
+var start = time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// playingAt returns a model playing a 3-minute track, elapsed into it as of
+// start.
+func playingAt(elapsed time.Duration) *model {
+	return &model{
+		State:             playing,
+		SongID:            "7",
+		Duration:          3 * time.Minute,
+		Elapsed:           elapsed,
+		LastElapsedUpdate: start,
+		Volume:            50,
+	}
+}
+
+func TestNoticeChangesPosition(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		from    time.Duration // Elapsed as of start
+		after   time.Duration // Time from start to the next poll
+		elapsed time.Duration // Elapsed at the next poll
+		want    overlayKind
+	}{
+		{"playing on", 1 * time.Minute, 10 * time.Second, 70*time.Second + 500*time.Millisecond, noOverlay},
+		{"seek forward", 1 * time.Minute, 10 * time.Second, 2 * time.Minute, seekOverlay},
+		{"seek back", 1 * time.Minute, 10 * time.Second, 30 * time.Second, seekOverlay},
+		{"seek to start", 1 * time.Minute, 10 * time.Second, 0, seekOverlay},
+		{"seek to start near end", 170 * time.Second, time.Second, 0, seekOverlay},
+		{"restart", 179 * time.Second, time.Second, 0, noOverlay},
+		{"restart just before end", 178 * time.Second, 500 * time.Millisecond, 0, noOverlay},
+		{"restart noticed late", 170 * time.Second, 30 * time.Second, 20 * time.Second, noOverlay},
+		{"seek after restart", 170 * time.Second, 30 * time.Second, 90 * time.Second, seekOverlay},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev := playingAt(tc.from)
+			now := start.Add(tc.after)
+			m := *prev
+			m.Elapsed = tc.elapsed
+			m.LastElapsedUpdate = now
+			m.noticeChanges(prev, now)
+			if m.Overlay != tc.want {
+				t.Errorf("overlay = %v, want %v", m.Overlay, tc.want)
+			}
+		})
+	}
+}
+
+func TestNoticeChangesVolume(t *testing.T) {
+	prev := playingAt(time.Minute)
+	m := *prev
+	m.Volume = 55
+	m.noticeChanges(prev, start)
+	if m.Overlay != volumeOverlay || !m.LastOverlay.Equal(start) {
+		t.Errorf("overlay = %v at %v, want %v at %v", m.Overlay, m.LastOverlay, volumeOverlay, start)
+	}
+}
+
+// overlaid draws the volume overlay, shown at start, over a blank view at now.
+func overlaid(m *model, fg screen, now time.Time) *view {
+	m.showOverlay(volumeOverlay, start)
+	c := &screenContext{model: m, now: now, glyphs: cfa635.NewGlyphManager(), cols: 20, rows: 4}
+	v := &view{LCD: display.NewFrame(c.cols, c.rows)}
+	drawOverlay(c, fg, v)
+	return v
+}
+
+func TestOverlayFades(t *testing.T) {
+	d := time.Duration(conf.OverlayDuration)
+	fade := time.Duration(float64(d) * overlayFade)
+	until := start.Add(d)
+
+	v := overlaid(playingAt(0), nil, start)
+	if got := strings.TrimRight(string(v.LCD[1]), " "); got != "Volume           50%" {
+		t.Errorf("row 1 = %q", got)
+	}
+	if !v.Next.Equal(until.Add(-fade)) {
+		t.Errorf("Next = %v before the end, want %v", until.Sub(v.Next), fade)
+	}
+
+	// Halfway through the fade, the overlay covers half the display.
+	v = overlaid(playingAt(0), nil, until.Add(-fade/2))
+	if got, want := string(v.LCD[1]), "Volume    "+strings.Repeat(" ", 10); got != want {
+		t.Errorf("row 1 = %q, want %q", got, want)
+	}
+	if got, want := until.Sub(v.Next), fade*9/20; got != want {
+		t.Errorf("Next = %v before the end, want %v", got, want)
+	}
+	for x, b := range v.LCD[2] {
+		if covered := b != ' '; covered != (x < 10) {
+			t.Errorf("bar cell %d = %q", x, b)
+		}
+	}
+
+	v = overlaid(playingAt(0), nil, until)
+	for y, row := range v.LCD {
+		if got := strings.TrimSpace(string(row)); got != "" {
+			t.Errorf("row %d = %q after the overlay ended", y, got)
+		}
+	}
+}
+
+func TestOverlayHiddenByMenu(t *testing.T) {
+	v := overlaid(playingAt(0), new(menuState), start)
+	for y, row := range v.LCD {
+		if got := strings.TrimSpace(string(row)); got != "" {
+			t.Errorf("row %d = %q under the menu", y, got)
+		}
+	}
+	if !v.Next.IsZero() {
+		t.Errorf("Next = %v, want zero", v.Next)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"time"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+// screen is something audiotrond can show on the display. Each screen lives in
+// its own file, which registers it from an init function.
+//
+// Screens don't load sprites themselves. They ask the GlyphManager for the
+// sprites they draw, and updateView loads whichever ones end up on the display.
+type screen interface {
+	// priority returns how much the screen wants to be shown, or 0 if it
+	// has nothing to show, and the time at which that might change on its
+	// own, or the zero time if it won't. The enabled screen with the
+	// highest priority is shown. priority must not change the screen's
+	// state, since it's called for every screen on every frame.
+	priority(c *screenContext) (int, time.Time)
+
+	// sprites returns the sprites that the screen is about to draw and
+	// can't do without. renderScreen requests them before render, so they
+	// get CGRAM slots ahead of glyphs for characters missing from the
+	// character ROM, which can fall back to transliterations.
+	sprites(c *screenContext) []*cfa635.Sprite
+
+	// render draws the screen. old is the view on the display, which may
+	// belong to another screen.
+	render(c *screenContext, old *view) *view
+
+	// handleKey responds to a gesture and reports whether it used it.
+	// Screens see gestures even when they aren't shown, so that they can
+	// bring themselves up.
+	handleKey(c *screenContext, e *cfa635.GestureEvent) bool
+}
+
+// An mpdUser is a screen that shows what MPD is doing. audiotrond connects to
+// MPD, and shows the connecting screen while it can't, only if an enabled
+// screen is an mpdUser.
+type mpdUser interface {
+	usesMPD() bool
+}
+
+// screenContext is what screens draw from and act on.
+type screenContext struct {
+	model *model
+	conn  *mpdConnection
+	now   time.Time
+
+	glyphs     *cfa635.GlyphManager
+	cols, rows int
+}
+
+type registeredScreen struct {
+	name   string
+	screen screen
+}
+
+// screens lists the registered screens in the order they were registered.
+var screens []registeredScreen
+
+// registerScreen adds s to the screens audiotrond can show. If name is
+// nonempty, the Screens setting can turn the screen on and off; otherwise, it's
+// always enabled.
+//
+// Screens register from init functions, which Go runs in the order of their
+// files' names, so that's the order in which screens are registered.
+func registerScreen(name string, s screen) {
+	screens = append(screens, registeredScreen{name, s})
+}
+
+// knownScreen reports whether the Screens setting can name a screen.
+func knownScreen(name string) bool {
+	for _, s := range screens {
+		if name != "" && s.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enabledScreens returns the screens that the configuration allows.
+func enabledScreens() []screen {
+	var r []screen
+	for _, s := range screens {
+		if s.name == "" || conf.enabled(s.name) {
+			r = append(r, s.screen)
+		}
+	}
+	return r
+}
+
+// wantsMPD reports whether an enabled screen uses MPD.
+func wantsMPD() bool { return conf.usesMPD() }
+
+// usesMPD reports whether c enables a screen that uses MPD.
+func (c *config) usesMPD() bool {
+	for _, s := range screens {
+		if s.name != "" && !c.enabled(s.name) {
+			continue
+		}
+		if u, ok := s.screen.(mpdUser); ok && u.usesMPD() {
+			return true
+		}
+	}
+	return false
+}
+
+// foreground returns the enabled screen with the highest priority and the
+// earliest time at which a different screen might win. Screens should choose
+// priorities that no other screen uses: foreground breaks ties in favor of the
+// screen registered first, which depends on file names.
+func foreground(c *screenContext) (screen, time.Time) {
+	var (
+		best     screen
+		bestPri  int
+		deadline time.Time
+	)
+	for _, s := range enabledScreens() {
+		p, change := s.priority(c)
+		deadline = earliest(deadline, change)
+		if best == nil || p > bestPri {
+			best, bestPri = s, p
+		}
+	}
+	return best, deadline
+}
+
+// renderScreen requests the sprites s needs and then renders it.
+func renderScreen(c *screenContext, s screen, old *view) *view {
+	for _, bitmap := range s.sprites(c) {
+		c.glyphs.Sprite(bitmap)
+	}
+	return s.render(c, old)
+}
+
+// dispatchKey offers a gesture to the foreground screen and then to the other
+// enabled screens in the order they were registered, stopping at the first one
+// that uses it. If none do, it performs the gesture's action from the key map.
+func dispatchKey(c *screenContext, fg screen, e *cfa635.GestureEvent) {
+	if fg != nil && fg.handleKey(c, e) {
+		return
+	}
+	for _, s := range enabledScreens() {
+		if s != fg && s.handleKey(c, e) {
+			return
+		}
+	}
+	handleKey(c, e)
+}
@@ -0,0 +1,101 @@
+// Copyright 2022 Benjamin Barenblat
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may not
+// use this file except in compliance with the License. You may obtain a copy of
+// the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations under
+// the License.
+
+package main
+
+import (
+	"testing"
+
+	"benjamin.barenblat.name/audiotrond/cfa635"
+)
+
+// withScreens runs the test with the Screens setting set to names.
+func withScreens(t *testing.T, names ...string) {
+	old := conf.Screens
+	conf.Screens = names
+	t.Cleanup(func() { conf.Screens = old })
+}
+
+func TestConnectingScreenFollowsMPDUsers(t *testing.T) {
+	c := &screenContext{model: new(model), conn: new(mpdConnection), now: start, glyphs: cfa635.NewGlyphManager(), cols: 20, rows: 4}
+
+	withScreens(t, "clock")
+	if wantsMPD() {
+		t.Error("wantsMPD with only the clock enabled")
+	}
+	if fg, _ := foreground(c); fg != (clockScreen{}) {
+		t.Errorf("foreground = %T, want the clock", fg)
+	}
+
+	withScreens(t, "clock", "menu")
+	if !wantsMPD() {
+		t.Error("!wantsMPD with the menu enabled")
+	}
+
+	withScreens(t, "mpd", "clock")
+	if !wantsMPD() {
+		t.Error("!wantsMPD with the MPD screen enabled")
+	}
+	if fg, _ := foreground(c); fg != (connectingScreen{}) {
+		t.Errorf("foreground = %T, want the connecting screen", fg)
+	}
+}
+
+func TestMenuCanBeDisabled(t *testing.T) {
+	withScreens(t, "mpd", "clock")
+	for _, s := range enabledScreens() {
+		if _, ok := s.(*menuState); ok {
+			t.Error("menu enabled without being listed")
+		}
+	}
+
+	c := defaultConfig()
+	c.Screens = stringList{"clock"}
+	c.MPD.Address = ""
+	if err := c.validate(); err != nil {
+		t.Errorf("validate with only the clock and no MPD address: %v", err)
+	}
+	c.Screens = stringList{"clock", "menu"}
+	if err := c.validate(); err == nil {
+		t.Error("validate accepted the menu with no MPD address")
+	}
+}
+
+func TestMenuPriorityDoesNotClose(t *testing.T) {
+	s := &menuState{stack: []*menu{{title: "Menu"}}}
+	c := &screenContext{model: &model{LastKeyPress: start}, conn: new(mpdConnection), now: start.Add(menuTimeout)}
+	if p, _ := s.priority(c); p != 0 {
+		t.Errorf("priority = %d after the timeout, want 0", p)
+	}
+	if !s.isOpen() {
+		t.Error("priority closed the menu")
+	}
+
+	// Any gesture after the timeout closes it.
+	e := &cfa635.GestureEvent{Gesture: cfa635.ShortPress, K: cfa635.DownButton, Time: c.now}
+	s.handleKey(c, e)
+	if s.isOpen() {
+		t.Error("menu still open after a gesture")
+	}
+}
+
+func TestClockFitsSmallDisplays(t *testing.T) {
+	for cols := 1; cols < 20; cols++ {
+		c := &screenContext{model: new(model), now: start, glyphs: cfa635.NewGlyphManager(), cols: cols, rows: 2}
+		v := clockScreen{}.render(c, nil)
+		if got, _ := v.LCD.Size(); got != cols {
+			t.Errorf("%d columns: clock is %d columns wide", cols, got)
+		}
+	}
+}
@@ -20,28 +20,44 @@ import (
 	"math"
 
 	"benjamin.barenblat.name/audiotrond/cfa635"
+	"benjamin.barenblat.name/audiotrond/display"
 )
 
 type view struct {
-	LCD               *cfa635.LCDState
+	LCD               display.Frame
 	DisplayBrightness float64
 	Mtime             time.Time
+
+	// Next is the earliest time at which the view might look different,
+	// or the zero time if it never changes on its own.
+	Next time.Time
 }
 
-func updateView(lcd *cfa635.Module, old, new *view) error {
-	if err := cfa635.Update(lcd, old.LCD, new.LCD); err != nil {
+// updateView changes the display from old to new, first loading the sprites
+// that new needs.
+func updateView(lcd display.Display, glyphs *cfa635.GlyphManager, old, new *view) error {
+	if err := glyphs.Commit(lcd, new.LCD); err != nil {
 		return err
 	}
+	return display.Update(lcd, old.state(), new.state())
+}
 
-	if new.DisplayBrightness != old.DisplayBrightness {
-		bright := new.DisplayBrightness
-		if bright < 0 {
-			bright = 0
-		}
-		if err := lcd.SetBacklight(int(math.Round(new.DisplayBrightness)), 0); err != nil {
-			return err
-		}
+// state returns the display state that v calls for.
+func (v *view) state() *display.State {
+	return &display.State{
+		Frame:     v.LCD,
+		Backlight: int(math.Round(math.Max(0, v.DisplayBrightness))),
 	}
+}
 
-	return nil
+// earliest returns the earliest of ts that isn't the zero time, or the zero
+// time if they all are.
+func earliest(ts ...time.Time) time.Time {
+	var r time.Time
+	for _, t := range ts {
+		if !t.IsZero() && (r.IsZero() || t.Before(r)) {
+			r = t
+		}
+	}
+	return r
 }